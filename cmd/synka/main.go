@@ -3,15 +3,27 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/amimof/synka/pkg/apis/synka/v1alpha1"
 	"github.com/amimof/synka/pkg/controller"
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"io/ioutil"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
+	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"strings"
 	"syscall"
 )
 
@@ -29,6 +41,12 @@ var (
 	masterURL            string
 	kubeconfig           string
 	informers            []string
+	httpAddress          string
+	adminAddress         string
+	leaderElect          bool
+	leaderElectNamespace string
+	leaderElectName      string
+	workers              int
 	onlyOneSignalHandler = make(chan struct{})
 	shutdownSignals      = []os.Signal{os.Kill, os.Interrupt, syscall.SIGTERM}
 	defaultInformers     = []string{"deployments.v1.apps", "pods.v1.", "namespaces.v1.", "services.v1.", "serviceaccounts.v1."}
@@ -38,7 +56,13 @@ func init() {
 	pflag.StringVar(&config, "config", "/etc/synka/config.yaml", "Path to synka configuration file.")
 	pflag.StringVar(&kubeconfig, "kubeconfig", "~/.kube/config", "Path to a kubeconfig. Only required if out-of-cluster. Synka synchronises configuration from the current-context defined in this file to contexts in kubeconfig defined by --config.")
 	pflag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
-	pflag.StringSliceVar(&informers, "informer", defaultInformers, "Resource to watch. This flag can be used multiple times.")
+	pflag.StringSliceVar(&informers, "informer", defaultInformers, "Resource to watch. This flag can be used multiple times. Ignored if discovery is enabled in --config.")
+	pflag.StringVar(&httpAddress, "http-address", ":8080", "Address to serve metrics and health checks on.")
+	pflag.StringVar(&adminAddress, "admin-address", "localhost:8081", "Address to serve dead letters and reconcile requests on. These endpoints are unauthenticated. Set to an empty string to disable them.")
+	pflag.BoolVar(&leaderElect, "leader-elect", false, "Elect a leader among the replicas of synka. Only the leader syncs resources.")
+	pflag.StringVar(&leaderElectNamespace, "leader-elect-namespace", "", "Namespace of the Lease used for leader election. Defaults to the namespace that synka runs in.")
+	pflag.StringVar(&leaderElectName, "leader-elect-name", "synka", "Name of the Lease used for leader election.")
+	pflag.IntVar(&workers, "workers", 8, "Number of resources that are synced in parallel, shared by all informers.")
 }
 
 // setupSignalHandler returns a stop channel which is closed when program receives a SIGKILL, SIGINT or SIGTERM.
@@ -65,14 +89,99 @@ func setupConfig() (*controller.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	return loadConfig()
+}
+
+// loadConfig unmarshals and validates the configuration most recently read by viper
+func loadConfig() (*controller.Config, error) {
 	var config *controller.Config
-	err = viper.Unmarshal(&config)
+	err := viper.Unmarshal(&config)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &controller.Config{}
+	}
+	err = config.Validate()
 	if err != nil {
 		return nil, err
 	}
 	return config, nil
 }
 
+// watchConfig reloads the configuration file when it changes and replaces the clusters in registry and the
+// sanitize rules in sanitizers. Invalid configuration is rejected and the previous configuration stays in effect.
+func watchConfig(current *controller.Config, registry *controller.ClusterRegistry, sanitizers *controller.SanitizerRegistry) {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		c, err := loadConfig()
+		if err != nil {
+			klog.Errorf("Rejecting configuration %s, keeping the previous configuration: %v", config, err)
+			return
+		}
+		if c.Name != current.Name || c.Instance != current.Instance || c.Strategy != current.Strategy || c.DriftPolicy != current.DriftPolicy || c.StatusAnnotation != current.StatusAnnotation || c.DeadLetterInterval != current.DeadLetterInterval || c.Resync != current.Resync || !reflect.DeepEqual(c.Resources, current.Resources) || !reflect.DeepEqual(c.Discovery, current.Discovery) {
+			klog.Infof("Changes to name, instance, strategy, driftPolicy, statusAnnotation, deadLetterInterval, resync, resources and discovery in %s are only applied on restart", config)
+		}
+		registry.SetStatic(c.Clusters)
+		sanitizers.SetRules(c.Sanitize)
+		klog.Infof("Reloaded configuration %s", config)
+	})
+	viper.WatchConfig()
+}
+
+// leaderElectionNamespace returns the namespace of the Lease used for leader election. Defaults to the namespace of the
+// service account that synka runs as, or the default namespace when running out-of-cluster
+func leaderElectionNamespace() string {
+	if leaderElectNamespace != "" {
+		return leaderElectNamespace
+	}
+	if ns, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		return strings.TrimSpace(string(ns))
+	}
+	return "default"
+}
+
+// hasResource returns true if the API server serves the given GroupVersionResource
+func hasResource(client discovery.DiscoveryInterface, gvr schema.GroupVersionResource) bool {
+	resources, err := client.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == gvr.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInformers parses the --informer flags and checks that each of them is served by the API server.
+// All problems found are returned as an aggregate error
+func parseInformers(client discovery.DiscoveryInterface, informers []string) ([]schema.GroupVersionResource, error) {
+	var gvrs []schema.GroupVersionResource
+	var errs []error
+	for _, informer := range informers {
+		gvr, _ := schema.ParseResourceArg(informer)
+		if gvr == nil {
+			errs = append(errs, fmt.Errorf("Invalid informer %s: expected the form resource.version.group", informer))
+			continue
+		}
+		if !hasResource(client, *gvr) {
+			errs = append(errs, fmt.Errorf("Invalid informer %s: resource %s is not served by the API server", informer, gvr.String()))
+			continue
+		}
+		gvrs = append(gvrs, *gvr)
+	}
+	return gvrs, utilerrors.NewAggregate(errs)
+}
+
+// flatten returns the errors of an aggregate error, or err itself if it isn't an aggregate
+func flatten(err error) []error {
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		return utilerrors.Flatten(agg).Errors()
+	}
+	return []error{err}
+}
+
 func main() {
 
 	// Setup version flag
@@ -90,10 +199,6 @@ func main() {
 	klog.InitFlags(nil)
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.Parse()
-	c, err := setupConfig()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-	}
 
 	// Show version if requested
 	if *showver {
@@ -110,13 +215,106 @@ func main() {
 	if err != nil {
 		klog.Fatalf("Error creating dynamic client for config: %s", err.Error())
 	}
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("Error creating client for config: %s", err.Error())
+	}
 
-	// Create & run a controller for each of the configured informers
+	// Validate configuration and informers, reporting all problems before exiting
+	var errs []error
+	c, err := setupConfig()
+	if err != nil {
+		errs = append(errs, flatten(err)...)
+	}
+	var gvrs []schema.GroupVersionResource
+	if c == nil || !c.Discovery.Enabled {
+		gvrs, err = parseInformers(cs.Discovery(), informers)
+		if err != nil {
+			errs = append(errs, flatten(err)...)
+		}
+	} else if pflag.CommandLine.Changed("informer") {
+		klog.Infof("Ignoring --informer, resources to watch are discovered")
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+
+	recorder := controller.NewEventRecorder(cs)
+
+	// Only sync resources once elected leader, if leader election is enabled
 	stopCh := setupSignalHandler()
-	for _, informer := range informers {
-		gvr, _ := schema.ParseResourceArg(informer)
-		controller := controller.New(dc, c, gvr)
-		go controller.Run(stopCh)
+	leading := controller.AlwaysLead()
+	if leaderElect {
+		identity, err := os.Hostname()
+		if err != nil {
+			klog.Fatalf("Error getting hostname for leader election: %s", err.Error())
+		}
+		leading = controller.RunLeaderElection(cs, leaderElectionNamespace(), leaderElectName, identity, stopCh)
+	}
+
+	// Watch sync policies if the SyncPolicy resource is installed
+	var policies *controller.PolicyStore
+	if hasResource(cs.Discovery(), v1alpha1.SyncPolicyResource) {
+		policies = controller.NewPolicyStore(dc)
+		go policies.Run(stopCh, leading)
+	} else {
+		klog.Infof("Resource %s not found, sync policies are disabled", v1alpha1.SyncPolicyResource.GroupResource().String())
+	}
+
+	// Watch clusters defined by SynkaCluster resources if the resource is installed
+	registry := controller.NewClusterRegistry(c.Clusters)
+	sanitizers := controller.NewSanitizerRegistry(c.Sanitize)
+	watchConfig(c, registry, sanitizers)
+	if hasResource(cs.Discovery(), v1alpha1.SynkaClusterResource) {
+		go controller.NewClusterWatcher(dc, cs.CoreV1(), registry).Run(stopCh, leading)
+	} else {
+		klog.Infof("Resource %s not found, only clusters in %s are used", v1alpha1.SynkaClusterResource.GroupResource().String(), config)
+	}
+
+	// Run a controller for each of the configured or discovered informers. The controllers share their workqueue
+	// and workers
+	manager := controller.NewManager(dc, recorder, policies, registry, sanitizers, c)
+	for i := range gvrs {
+		manager.Add(gvrs[i])
+	}
+	// Not ready until the first discovery has added its resources to the manager
+	var synced []cache.InformerSynced
+	if c.Discovery.Enabled {
+		// Pick up resources of CustomResourceDefinitions installed at runtime if they can be watched
+		var crds dynamic.Interface
+		if hasResource(cs.Discovery(), controller.CustomResourceDefinitionResource) {
+			crds = dc
+		} else {
+			klog.Infof("Resource %s not found, resources installed at runtime are not discovered", controller.CustomResourceDefinitionResource.GroupResource().String())
+		}
+		discoverer := controller.NewDiscoverer(cs.Discovery(), crds, c.Discovery, manager)
+		synced = append(synced, discoverer.HasSynced)
+		go discoverer.Run(stopCh)
+	}
+	go manager.Run(workers, stopCh, leading)
+	health := controller.NewHealthHandler(registry, manager, synced...)
+	deadLetters := controller.NewDeadLetterHandler(manager)
+
+	// Serve metrics and health checks
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	health.Register(mux)
+	go func() {
+		klog.Fatal(http.ListenAndServe(httpAddress, mux))
+	}()
+
+	// Serve the endpoints that inspect and trigger syncs on a separate address, which only listens on localhost
+	// unless configured otherwise, since they aren't authenticated
+	if adminAddress != "" {
+		admin := http.NewServeMux()
+		deadLetters.Register(admin)
+		controller.NewReconcileHandler(registry).Register(admin)
+		go func() {
+			klog.Fatal(http.ListenAndServe(adminAddress, admin))
+		}()
 	}
 
 	// Block until we get signal to quit
@@ -0,0 +1,155 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out
+func (in *SyncPolicy) DeepCopyInto(out *SyncPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy creates a new deep copy of the receiver
+func (in *SyncPolicy) DeepCopy() *SyncPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject creates a new deep copy of the receiver as a runtime.Object
+func (in *SyncPolicy) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *SyncPolicySpec) DeepCopyInto(out *SyncPolicySpec) {
+	*out = *in
+	if in.Resources != nil {
+		out.Resources = make([]GroupVersionResource, len(in.Resources))
+		copy(out.Resources, in.Resources)
+	}
+	out.NamespaceSelector = copyLabelSelector(in.NamespaceSelector)
+	out.Selector = copyLabelSelector(in.Selector)
+	out.ClusterSelector = copyLabelSelector(in.ClusterSelector)
+	if in.Clusters != nil {
+		out.Clusters = make([]string, len(in.Clusters))
+		copy(out.Clusters, in.Clusters)
+	}
+	if in.ExcludeClusters != nil {
+		out.ExcludeClusters = make([]string, len(in.ExcludeClusters))
+		copy(out.ExcludeClusters, in.ExcludeClusters)
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *SyncPolicyStatus) DeepCopyInto(out *SyncPolicyStatus) {
+	*out = *in
+	if in.Clusters != nil {
+		out.Clusters = make([]ClusterSyncStatus, len(in.Clusters))
+		copy(out.Clusters, in.Clusters)
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *SyncPolicyList) DeepCopyInto(out *SyncPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]SyncPolicy, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy creates a new deep copy of the receiver
+func (in *SyncPolicyList) DeepCopy() *SyncPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject creates a new deep copy of the receiver as a runtime.Object
+func (in *SyncPolicyList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *SynkaCluster) DeepCopyInto(out *SynkaCluster) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy creates a new deep copy of the receiver
+func (in *SynkaCluster) DeepCopy() *SynkaCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(SynkaCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject creates a new deep copy of the receiver as a runtime.Object
+func (in *SynkaCluster) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *SynkaClusterStatus) DeepCopyInto(out *SynkaClusterStatus) {
+	*out = *in
+	if in.LastSyncTime != nil {
+		out.LastSyncTime = in.LastSyncTime.DeepCopy()
+	}
+}
+
+// DeepCopyInto copies the receiver into out
+func (in *SynkaClusterList) DeepCopyInto(out *SynkaClusterList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]SynkaCluster, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy creates a new deep copy of the receiver
+func (in *SynkaClusterList) DeepCopy() *SynkaClusterList {
+	if in == nil {
+		return nil
+	}
+	out := new(SynkaClusterList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject creates a new deep copy of the receiver as a runtime.Object
+func (in *SynkaClusterList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// copyLabelSelector returns a deep copy of a label selector
+func copyLabelSelector(in *metav1.LabelSelector) *metav1.LabelSelector {
+	if in == nil {
+		return nil
+	}
+	return in.DeepCopy()
+}
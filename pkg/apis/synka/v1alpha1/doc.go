@@ -0,0 +1,3 @@
+// Package v1alpha1 contains the v1alpha1 version of the synka.io API group
+// +groupName=synka.io
+package v1alpha1
@@ -0,0 +1,39 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupName is the name of the synka API group
+const GroupName = "synka.io"
+
+var (
+	// SchemeGroupVersion is the group version used to register these objects
+	SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: "v1alpha1"}
+	// SyncPolicyResource is the GroupVersionResource of SyncPolicy
+	SyncPolicyResource = SchemeGroupVersion.WithResource("syncpolicies")
+	// SynkaClusterResource is the GroupVersionResource of SynkaCluster
+	SynkaClusterResource = SchemeGroupVersion.WithResource("synkaclusters")
+	// SchemeBuilder collects the functions that add the types of this group to a scheme
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	// AddToScheme adds the types of this group to a scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+// Resource takes an unqualified resource and returns a group qualified GroupResource
+func Resource(resource string) schema.GroupResource {
+	return SchemeGroupVersion.WithResource(resource).GroupResource()
+}
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&SyncPolicy{},
+		&SyncPolicyList{},
+		&SynkaCluster{},
+		&SynkaClusterList{},
+	)
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
@@ -0,0 +1,123 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SyncPolicy selects resources in the cluster that synka runs in and defines how they are synced to
+// other clusters. It is an alternative to annotating each resource with synka.io/sync.
+type SyncPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SyncPolicySpec   `json:"spec"`
+	Status SyncPolicyStatus `json:"status,omitempty"`
+}
+
+// SyncPolicySpec is the specification of a SyncPolicy
+type SyncPolicySpec struct {
+	// Resources are the kinds of resources that the policy applies to
+	Resources []GroupVersionResource `json:"resources"`
+	// NamespaceSelector selects the namespaces of resources. Cluster scoped resources
+	// are only matched if the selector is omitted
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Selector selects resources by their labels. All resources are selected if omitted
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Clusters limits the clusters that resources are synced to. All clusters are used if empty
+	Clusters []string `json:"clusters,omitempty"`
+	// ExcludeClusters are clusters that resources are never synced to
+	ExcludeClusters []string `json:"excludeClusters,omitempty"`
+	// ClusterSelector selects the clusters that resources are synced to by their labels
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	// SkipExisting leaves resources that already exist in a cluster untouched
+	SkipExisting bool `json:"skipExisting,omitempty"`
+	// Orphan keeps resources in the clusters when they are deleted
+	Orphan bool `json:"orphan,omitempty"`
+	// Adopt allows synka to take over resources in the clusters that it didn't create
+	Adopt bool `json:"adopt,omitempty"`
+	// Strategy is the way that resources are written to clusters, either update, apply or merge. Defaults to the
+	// strategy in the synka configuration
+	Strategy string `json:"strategy,omitempty"`
+	// Force takes ownership of fields that are owned by others when using the apply strategy
+	Force bool `json:"force,omitempty"`
+	// DriftPolicy is what happens when resources are changed in a cluster, either revert, report or ignore.
+	// Defaults to the drift policy in the synka configuration
+	DriftPolicy string `json:"driftPolicy,omitempty"`
+}
+
+// GroupVersionResource identifies a kind of resource
+type GroupVersionResource struct {
+	Group    string `json:"group,omitempty"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+}
+
+// SyncPolicyStatus is the observed state of a SyncPolicy
+type SyncPolicyStatus struct {
+	// Matched is the number of resources that the policy applies to
+	Matched int `json:"matched"`
+	// Clusters is the number of resources that are in sync on each of the clusters
+	Clusters []ClusterSyncStatus `json:"clusters,omitempty"`
+}
+
+// ClusterSyncStatus is the sync state of a single cluster
+type ClusterSyncStatus struct {
+	Name   string `json:"name"`
+	InSync int    `json:"inSync"`
+}
+
+// SyncPolicyList is a list of SyncPolicy
+type SyncPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []SyncPolicy `json:"items"`
+}
+
+// SynkaCluster is a cluster that synka syncs resources to. Credentials are read from a Secret.
+// The labels of a SynkaCluster are used to select it with the synka.io/cluster-selector annotation.
+type SynkaCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SynkaClusterSpec   `json:"spec"`
+	Status SynkaClusterStatus `json:"status,omitempty"`
+}
+
+// SynkaClusterSpec is the specification of a SynkaCluster
+type SynkaClusterSpec struct {
+	// Server is the address of the Kubernetes API server. Not required if the secret contains a kubeconfig
+	Server string `json:"server,omitempty"`
+	// InsecureSkipTLSVerify disables verification of the server certificate
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+	// SecretRef references a Secret with either a kubeconfig key, or any of the ca, cert, key and token keys
+	SecretRef SecretReference `json:"secretRef"`
+	// Context is the context to use if the secret contains a kubeconfig. Defaults to the current context
+	Context string `json:"context,omitempty"`
+}
+
+// SecretReference references a Secret in a namespace
+type SecretReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// SynkaClusterStatus is the observed state of a SynkaCluster
+type SynkaClusterStatus struct {
+	// Connected is true if the API server of the cluster could be reached
+	Connected bool `json:"connected"`
+	// ServerVersion is the version of the API server of the cluster
+	ServerVersion string `json:"serverVersion,omitempty"`
+	// Message describes why the cluster can't be reached
+	Message string `json:"message,omitempty"`
+	// LastSyncTime is the time a resource was last successfully synced to the cluster
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+// SynkaClusterList is a list of SynkaCluster
+type SynkaClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []SynkaCluster `json:"items"`
+}
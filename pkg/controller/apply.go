@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"context"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// fieldManager is the name that synka uses to manage fields with server-side apply
+const fieldManager = "synka"
+
+// apply creates or updates the resource u in a cluster with server-side apply, so that synka only owns the fields
+// that it writes and leaves fields set by others in the cluster alone. Like updateOrCreate, existing resources are
+// only modified if replace is true and the resource is owned by synka or adopt is true. Fields owned by other
+// managers are taken over if force is true, otherwise conflicting changes fail. Returns the written resource along
+// with the result of the write.
+func apply(ctx context.Context, client dynamic.Interface, gvr *schema.GroupVersionResource, u *unstructured.Unstructured, replace bool, adopt bool, force bool) (*unstructured.Unstructured, string, error) {
+
+	// Check ownership of the resource if it already exists
+	result, err := client.Resource(*gvr).Namespace(u.GetNamespace()).Get(ctx, u.GetName(), v1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, "", err
+	}
+	op := resultCreated
+	existing := ""
+	if err == nil {
+		if !replace {
+			return result, resultSkipped, nil
+		}
+		if !adopt && !isAdoptable(result) && !isOwned(result, u, false) {
+			return nil, "", &OwnershipError{Namespace: u.GetNamespace(), Name: u.GetName()}
+		}
+		op = resultUpdated
+		existing = result.GetResourceVersion()
+	}
+
+	data, err := u.MarshalJSON()
+	if err != nil {
+		return nil, "", err
+	}
+	result, err = client.Resource(*gvr).Namespace(u.GetNamespace()).Patch(ctx, u.GetName(), types.ApplyPatchType, data, v1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	// The API server keeps the resource version of patches that don't change anything
+	if existing != "" && result.GetResourceVersion() == existing {
+		return result, resultUnchanged, nil
+	}
+	return result, op, nil
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"testing"
+)
+
+// newApplyClient returns a fake client that answers apply patches with the applied resource
+func newApplyClient(objects ...runtime.Object) (*fake.FakeDynamicClient, *[]clienttesting.PatchActionImpl) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	var patches []clienttesting.PatchActionImpl
+	client.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patch := action.(clienttesting.PatchActionImpl)
+		patches = append(patches, patch)
+		u := &unstructured.Unstructured{}
+		return true, u, u.UnmarshalJSON(patch.Patch)
+	})
+	return client, &patches
+}
+
+func TestApply(t *testing.T) {
+	config := &Config{Name: "source"}
+	source := newConfigMap("cm", nil)
+	desired := source.DeepCopy()
+	setOwnership(desired, source, config)
+
+	client, patches := newApplyClient()
+	result, _, err := apply(context.Background(), client, configMapGVR, desired, true, false, false)
+	assert.NoError(t, err)
+	assert.Len(t, *patches, 1, "Expected missing resource to be applied")
+	assert.Equal(t, types.ApplyPatchType, (*patches)[0].PatchType, "Unexpected patch type")
+	assert.Equal(t, desired, result, "Unexpected result")
+
+	foreign := newConfigMap("cm", map[string]string{"app": "other"})
+	client, patches = newApplyClient(foreign)
+	_, _, err = apply(context.Background(), client, configMapGVR, desired, true, false, false)
+	assert.IsType(t, &OwnershipError{}, err)
+	assert.Empty(t, *patches, "Expected foreign resource to be left alone")
+
+	result, _, err = apply(context.Background(), client, configMapGVR, desired, false, false, false)
+	assert.NoError(t, err)
+	assert.Empty(t, *patches, "Expected existing resource to be skipped")
+	assert.Equal(t, "other", result.GetLabels()["app"], "Expected existing resource to be returned")
+
+	_, _, err = apply(context.Background(), client, configMapGVR, desired, true, true, true)
+	assert.NoError(t, err)
+	assert.Len(t, *patches, 1, "Expected adopted resource to be applied")
+}
+
+func TestApply_unchanged(t *testing.T) {
+	config := &Config{Name: "source"}
+	source := newConfigMap("cm", nil)
+	desired := source.DeepCopy()
+	setOwnership(desired, source, config)
+	live := desired.DeepCopy()
+	live.SetResourceVersion("1")
+
+	version := "1"
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), live)
+	client.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		u := live.DeepCopy()
+		u.SetResourceVersion(version)
+		return true, u, nil
+	})
+	_, op, err := apply(context.Background(), client, configMapGVR, desired, true, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, resultUnchanged, op, "Expected patch that keeps the resource version to be unchanged")
+
+	version = "2"
+	_, op, err = apply(context.Background(), client, configMapGVR, desired, true, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, resultUpdated, op, "Expected patch that changes the resource version to be updated")
+}
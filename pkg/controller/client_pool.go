@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog"
+	"sync"
+	"time"
+)
+
+// ClientPool holds one dynamic client per cluster that is shared by all controllers. A client is rebuilt
+// when the configuration of its cluster changes. A ClientPool is safe for concurrent use.
+type ClientPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+}
+
+type pooledClient struct {
+	cluster Cluster
+	client  dynamic.Interface
+	health  ClusterHealth
+}
+
+// ClusterHealth is the health of the connection to a cluster, as observed from requests made to it
+type ClusterHealth struct {
+	Healthy     bool      `json:"healthy"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastChecked time.Time `json:"lastChecked,omitempty"`
+}
+
+// NewClientPool creates an empty ClientPool
+func NewClientPool() *ClientPool {
+	return &ClientPool{
+		clients: make(map[string]*pooledClient),
+	}
+}
+
+// Get returns the client of a cluster. A new client is created if there is none,
+// or if the configuration of the cluster has changed since the client was created.
+func (p *ClientPool) Get(cluster Cluster) (dynamic.Interface, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pc, ok := p.clients[cluster.Name]; ok && pc.cluster.equal(cluster) {
+		return pc.client, nil
+	}
+
+	// Build a client from a copy so that clients cached on the cluster are never reused
+	c := cluster
+	c.client = nil
+	client, err := c.GetClient(nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.clients[cluster.Name]; ok {
+		klog.Infof("Configuration of cluster %s changed, rebuilding client", cluster.Name)
+	}
+	p.clients[cluster.Name] = &pooledClient{
+		cluster: cluster,
+		client:  client,
+		health:  ClusterHealth{Healthy: true},
+	}
+	return client, nil
+}
+
+// Observe records the result of a request to a cluster. Errors returned by the API server, or by synka
+// itself, mean that the cluster is reachable. Any other error marks the cluster as unhealthy.
+func (p *ClientPool) Observe(name string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc, ok := p.clients[name]
+	if !ok {
+		return
+	}
+	pc.health.LastChecked = time.Now()
+	if reachable(err) {
+		pc.health.Healthy = true
+		pc.health.LastError = ""
+		return
+	}
+	if pc.health.Healthy {
+		klog.Infof("Cluster %s is unhealthy: %v", name, err)
+	}
+	pc.health.Healthy = false
+	pc.health.LastError = err.Error()
+}
+
+// Health returns the health of every cluster that has a client
+func (p *ClientPool) Health() map[string]ClusterHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make(map[string]ClusterHealth)
+	for name, pc := range p.clients {
+		res[name] = pc.health
+	}
+	return res
+}
+
+// Remove discards the client of a cluster
+func (p *ClientPool) Remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.clients, name)
+}
+
+// reachable returns false if err is caused by a failure to connect to a cluster
+func reachable(err error) bool {
+	switch err.(type) {
+	case nil, errors.APIStatus, *OwnershipError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"testing"
+)
+
+func TestClientPool_Get(t *testing.T) {
+	p := NewClientPool()
+	cluster := defaultCluster
+
+	client, err := p.Get(cluster)
+	assert.NoError(t, err)
+	again, err := p.Get(cluster)
+	assert.NoError(t, err)
+	assert.True(t, client == again, "Expected client to be reused")
+
+	cluster.Token = "token"
+	rebuilt, err := p.Get(cluster)
+	assert.NoError(t, err)
+	assert.False(t, client == rebuilt, "Expected client to be rebuilt when configuration changes")
+
+	p.Remove(cluster.Name)
+	assert.Empty(t, p.Health(), "Expected client to be removed")
+}
+
+func TestClientPool_Observe(t *testing.T) {
+	p := NewClientPool()
+	_, err := p.Get(defaultCluster)
+	assert.NoError(t, err)
+	assert.True(t, p.Health()[defaultCluster.Name].Healthy, "Expected new client to be healthy")
+
+	p.Observe(defaultCluster.Name, fmt.Errorf("dial tcp: connection refused"))
+	health := p.Health()[defaultCluster.Name]
+	assert.False(t, health.Healthy, "Expected connection error to mark cluster unhealthy")
+	assert.Equal(t, "dial tcp: connection refused", health.LastError, "Unexpected error")
+
+	p.Observe(defaultCluster.Name, errors.NewNotFound(configMapGVR.GroupResource(), "cm"))
+	assert.True(t, p.Health()[defaultCluster.Name].Healthy, "Expected API error to mark cluster healthy")
+}
@@ -2,17 +2,259 @@ package controller
 
 import (
 	"encoding/base64"
+	"fmt"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/homedir"
+	"k8s.io/client-go/util/workqueue"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 )
 
+// Defaults of the settings of a cluster
+const (
+	defaultClusterTimeout = 30 * time.Second
+	defaultMaxRetries     = 5
+	defaultBackoff        = 5 * time.Millisecond
+	defaultMaxBackoff     = 1000 * time.Second
+)
+
+// defaultDeadLetterInterval is the time between retries of dead letters if the configuration doesn't set one
+const defaultDeadLetterInterval = 10 * time.Minute
+
 // Config is synka configuration
 type Config struct {
+	// Name of the cluster that synka runs in. Recorded on every synced resource
+	Name string
+	// Instance identifies this synka installation. Recorded on every synced resource
+	Instance string
 	Clusters []Cluster
+	// Strategy is the default way that resources are written to clusters. Defaults to update
+	Strategy Strategy `yaml:"strategy,omitempty"`
+	// DriftPolicy is the default policy for resources that are changed in clusters. Defaults to ignore
+	DriftPolicy DriftPolicy `yaml:"driftPolicy,omitempty"`
+	// StatusAnnotation enables writing a summary of the sync results of each resource to its synka.io/status annotation
+	StatusAnnotation bool `yaml:"statusAnnotation,omitempty"`
+	// Sanitize lists extra fields to remove from resources before they are written to clusters
+	Sanitize []SanitizeRule `yaml:"sanitize,omitempty"`
+	// DeadLetterInterval is the time between retries of syncs that ran out of retries. Defaults to 10m
+	DeadLetterInterval time.Duration `yaml:"deadLetterInterval,omitempty"`
+	// Resync is the time between full resyncs of every resource to the clusters. Disabled if 0
+	Resync time.Duration `yaml:"resync,omitempty"`
+	// Resources overrides settings of the controllers of individual resources
+	Resources []ResourceConfig `yaml:"resources,omitempty"`
+	// Discovery finds the resources to watch with the discovery API instead of the --informer flags
+	Discovery DiscoveryConfig `yaml:"discovery,omitempty"`
+}
+
+// ResourceConfig holds the settings of the controller of a single resource
+type ResourceConfig struct {
+	// Resource is the resource in the same form as the --informer flag, for example deployments.v1.apps
+	Resource string `yaml:"resource"`
+	// Workers is the maximum number of resources of this kind that are synced in parallel by the workers set with
+	// the --workers flag. Defaults to no limit
+	Workers int `yaml:"workers,omitempty"`
+	// Resync is the time between full resyncs of the resource to the clusters. Defaults to resync of the Config
+	Resync time.Duration `yaml:"resync,omitempty"`
+}
+
+// Validate checks that the configuration is usable. All problems found are returned as an aggregate error
+func (c *Config) Validate() error {
+	var errs []error
+	names := make(map[string]bool)
+	for i, cluster := range c.Clusters {
+		if cluster.Name == "" {
+			errs = append(errs, fmt.Errorf("Cluster at index %d has no name", i))
+		} else if names[cluster.Name] {
+			errs = append(errs, fmt.Errorf("Cluster %s is defined more than once", cluster.Name))
+		}
+		names[cluster.Name] = true
+		for _, err := range cluster.validate() {
+			errs = append(errs, fmt.Errorf("Cluster %s: %v", cluster.Name, err))
+		}
+	}
+	if _, err := parseStrategy(string(c.Strategy)); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseDriftPolicy(string(c.DriftPolicy)); err != nil {
+		errs = append(errs, err)
+	}
+	if c.DeadLetterInterval < 0 {
+		errs = append(errs, fmt.Errorf("DeadLetterInterval can't be negative"))
+	}
+	if c.Resync < 0 {
+		errs = append(errs, fmt.Errorf("Resync can't be negative"))
+	}
+	for i, rule := range c.Sanitize {
+		for _, err := range rule.validate() {
+			errs = append(errs, fmt.Errorf("Sanitize rule at index %d: %v", i, err))
+		}
+	}
+	for _, err := range c.Discovery.validate() {
+		errs = append(errs, fmt.Errorf("Discovery: %v", err))
+	}
+	resources := make(map[string]bool)
+	for i, r := range c.Resources {
+		if gvr, _ := schema.ParseResourceArg(r.Resource); gvr == nil {
+			errs = append(errs, fmt.Errorf("Resource at index %d: invalid resource %q, expected the form resource.version.group", i, r.Resource))
+		} else if resources[gvr.String()] {
+			errs = append(errs, fmt.Errorf("Resource %s is configured more than once", r.Resource))
+		} else {
+			resources[gvr.String()] = true
+		}
+		if r.Workers < 0 {
+			errs = append(errs, fmt.Errorf("Resource %s: workers can't be negative", r.Resource))
+		}
+		if r.Resync < 0 {
+			errs = append(errs, fmt.Errorf("Resource %s: resync can't be negative", r.Resource))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validate returns all problems with the configuration of a cluster
+func (c *Cluster) validate() []error {
+	var errs []error
+	switch {
+	case c.Kubeconfig != "":
+		if c.Cert != "" || c.Key != "" || c.Ca != "" || c.Token != "" {
+			errs = append(errs, fmt.Errorf("Kubeconfig can't be combined with cert, key, ca or token"))
+		}
+		// Build the transport as well, since auth providers and exec plugins are only loaded when a client is created
+		if config, err := c.RESTConfig(); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid kubeconfig %s: %v", c.Kubeconfig, err))
+		} else if _, err := rest.TransportFor(config); err != nil {
+			errs = append(errs, fmt.Errorf("Can't create client from kubeconfig %s: %v", c.Kubeconfig, err))
+		}
+	case c.Server == "":
+		errs = append(errs, fmt.Errorf("No server"))
+	}
+	if c.Server != "" {
+		if u, err := url.Parse(c.Server); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid server: %v", err))
+		} else if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("Invalid server %s: expected an http or https URL", c.Server))
+		}
+	}
+	if c.Proxy != "" {
+		if u, err := url.Parse(c.Proxy); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("Invalid proxy %s: expected a URL", c.Proxy))
+		}
+	}
+	if c.Timeout < 0 || c.MaxRetries < 0 || c.Backoff < 0 || c.MaxBackoff < 0 {
+		errs = append(errs, fmt.Errorf("Timeout, maxRetries, backoff and maxBackoff can't be negative"))
+	}
+	if c.Backoff > 0 && c.MaxBackoff > 0 && c.Backoff > c.MaxBackoff {
+		errs = append(errs, fmt.Errorf("Backoff can't be longer than maxBackoff"))
+	}
+	fields := []struct {
+		name string
+		val  string
+	}{{"cert", c.Cert}, {"key", c.Key}, {"ca", c.Ca}}
+	for _, field := range fields {
+		if _, err := base64.StdEncoding.DecodeString(field.val); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid base64 in %s: %v", field.name, err))
+		}
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		errs = append(errs, fmt.Errorf("Both cert and key must be set to use client certificate authentication"))
+	}
+	if c.Cert != "" && c.Token != "" {
+		errs = append(errs, fmt.Errorf("Only one of cert and token can be set"))
+	}
+	if c.Ca != "" && c.InsecureSkipTLSVerify {
+		errs = append(errs, fmt.Errorf("Only one of ca and insecure-skip-tls-verify can be set"))
+	}
+	return errs
+}
+
+// instanceName returns the name of this synka instance
+func (c *Config) instanceName() string {
+	if c.Instance == "" {
+		return defaultInstance
+	}
+	return c.Instance
+}
+
+// defaultStrategy returns the strategy used for resources that don't specify one
+func (c *Config) defaultStrategy() Strategy {
+	if c.Strategy == "" {
+		return StrategyUpdate
+	}
+	return c.Strategy
+}
+
+// defaultDriftPolicy returns the drift policy used for resources that don't specify one
+func (c *Config) defaultDriftPolicy() DriftPolicy {
+	if c.DriftPolicy == "" {
+		return DriftIgnore
+	}
+	return c.DriftPolicy
+}
+
+// resourceConfig returns the settings of the controller of the given resource, if there are any
+func (c *Config) resourceConfig(gvr schema.GroupVersionResource) (ResourceConfig, bool) {
+	for _, r := range c.Resources {
+		if parsed, _ := schema.ParseResourceArg(r.Resource); parsed != nil && *parsed == gvr {
+			return r, true
+		}
+	}
+	return ResourceConfig{}, false
+}
+
+// workersFor returns the maximum number of resources of the given kind that are synced in parallel, or 0 if the
+// number isn't limited
+func (c *Config) workersFor(gvr schema.GroupVersionResource) int {
+	if r, ok := c.resourceConfig(gvr); ok {
+		return r.Workers
+	}
+	return 0
+}
+
+// resyncFor returns the time between full resyncs of the given resource, or 0 if resyncs are disabled
+func (c *Config) resyncFor(gvr schema.GroupVersionResource) time.Duration {
+	if r, ok := c.resourceConfig(gvr); ok && r.Resync > 0 {
+		return r.Resync
+	}
+	return c.Resync
+}
+
+// resyncCheckPeriod returns the shortest time between full resyncs of any resource, or 0 if resyncs are disabled
+// for every resource
+func (c *Config) resyncCheckPeriod() time.Duration {
+	period := c.Resync
+	for _, r := range c.Resources {
+		if r.Resync > 0 && (period == 0 || r.Resync < period) {
+			period = r.Resync
+		}
+	}
+	return period
+}
+
+// deadLetterInterval returns the time between retries of dead letters
+func (c *Config) deadLetterInterval() time.Duration {
+	if c.DeadLetterInterval <= 0 {
+		return defaultDeadLetterInterval
+	}
+	return c.DeadLetterInterval
+}
+
+// sourceName returns the name of the cluster that synka runs in
+func (c *Config) sourceName() string {
+	if c.Name == "" {
+		return defaultSourceName
+	}
+	return c.Name
 }
 
 // Cluster is a Kubernetes cluster to witch synka will post resources to
@@ -24,8 +266,56 @@ type Cluster struct {
 	Key                   string `yaml:"key,omitempty"`
 	Ca                    string `yaml:"ca,omitempty"`
 	Token                 string `yaml:"token,omitempty"`
-	client                dynamic.Interface
-	err                   error
+	// Labels are used to select clusters with the synka.io/cluster-selector annotation
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Kubeconfig is the path to a kubeconfig file. Credentials, exec plugins and auth providers of the file
+	// are used instead of the inline fields. Server overrides the server in the file if set
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	// Context is the context in Kubeconfig to use. Defaults to the current context of the file
+	Context string `yaml:"context,omitempty"`
+	// Proxy is the URL of a proxy that is used to connect to the cluster
+	Proxy string `yaml:"proxy,omitempty"`
+	// Timeout limits the time taken to write a resource to the cluster. Defaults to 30s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// MaxRetries is the number of times a failed sync to the cluster is retried before it becomes a dead letter. Defaults to 5
+	MaxRetries int `yaml:"maxRetries,omitempty"`
+	// Backoff is the delay before the first retry of a failed sync to the cluster. The delay doubles with every
+	// retry up to MaxBackoff. Defaults to 5ms
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+	// MaxBackoff is the longest delay between retries of a failed sync to the cluster. Defaults to 1000s
+	MaxBackoff time.Duration `yaml:"maxBackoff,omitempty"`
+	// kubeconfig is read from the secret of a SynkaCluster. Takes precedence over all other fields except Server
+	kubeconfig []byte
+	client     dynamic.Interface
+	err        error
+}
+
+// timeout returns the time allowed for writing a resource to the cluster
+func (c *Cluster) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultClusterTimeout
+	}
+	return c.Timeout
+}
+
+// maxRetries returns the number of times a failed sync to the cluster is retried
+func (c *Cluster) maxRetries() int {
+	if c.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	return c.MaxRetries
+}
+
+// rateLimiter returns a rate limiter that delays retries of failed syncs to the cluster
+func (c *Cluster) rateLimiter() workqueue.RateLimiter {
+	backoff, maxBackoff := c.Backoff, c.MaxBackoff
+	if backoff == 0 {
+		backoff = defaultBackoff
+	}
+	if maxBackoff == 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	return workqueue.NewItemExponentialFailureRateLimiter(backoff, maxBackoff)
 }
 
 // GetClient creates and returns a dynamic client that can be used to interact with a cluster
@@ -34,11 +324,8 @@ func (c *Cluster) GetClient(gvr *schema.GroupVersionResource) (dynamic.Interface
 		return c.client, nil
 	}
 
-	// Acquire config
-	config := getConfigForCluster(c)
-
 	// Create a client configuration instance
-	clientconfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	clientconfig, err := c.RESTConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +342,45 @@ func (c *Cluster) GetClient(gvr *schema.GroupVersionResource) (dynamic.Interface
 	return c.client, nil
 }
 
+// RESTConfig returns a client configuration for the cluster
+func (c *Cluster) RESTConfig() (*rest.Config, error) {
+
+	// Acquire config
+	config, err := getConfigForCluster(c)
+	if err != nil {
+		return nil, err
+	}
+	restconfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Route requests through a proxy
+	if c.Proxy != "" {
+		proxy, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		restconfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			if t, ok := rt.(*http.Transport); ok {
+				t = t.Clone()
+				t.Proxy = http.ProxyURL(proxy)
+				return t
+			}
+			return rt
+		})
+	}
+
+	return restconfig, nil
+}
+
+// equal returns true if c and o have the same configuration
+func (c Cluster) equal(o Cluster) bool {
+	c.client, c.err = nil, nil
+	o.client, o.err = nil, nil
+	return reflect.DeepEqual(c, o)
+}
+
 // Takes a base64 encoded string, decodes it and converts it into a byte array
 func b64ToBytes(str string) []byte {
 	var b []byte
@@ -65,9 +391,42 @@ func b64ToBytes(str string) []byte {
 	return data
 }
 
-// getConfigForCluster creates an instance api.Config that can be used to create a client config
-// that in turn is used to create a dynamic client.
-func getConfigForCluster(c *Cluster) *api.Config {
+// getConfigForCluster creates a client config that in turn is used to create a dynamic client. Clusters referencing
+// a kubeconfig file are loaded using the clientcmd loading rules, other clusters are built from the inline fields.
+func getConfigForCluster(c *Cluster) (clientcmd.ClientConfig, error) {
+	overrides := &clientcmd.ConfigOverrides{}
+	overrides.ClusterInfo.Server = c.Server
+
+	// Kubeconfig file
+	if c.Kubeconfig != "" {
+		rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: expandPath(c.Kubeconfig)}
+		overrides.CurrentContext = c.Context
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides), nil
+	}
+
+	// Kubeconfig read from a SynkaCluster secret
+	if len(c.kubeconfig) > 0 {
+		config, err := clientcmd.Load(c.kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		overrides.CurrentContext = c.Context
+		return clientcmd.NewDefaultClientConfig(*config, overrides), nil
+	}
+
+	return clientcmd.NewDefaultClientConfig(*getInlineConfigForCluster(c), &clientcmd.ConfigOverrides{}), nil
+}
+
+// expandPath replaces a leading ~ in path with the home directory of the current user
+func expandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(homedir.HomeDir(), path[1:])
+	}
+	return path
+}
+
+// getInlineConfigForCluster creates an instance api.Config from the inline fields of a cluster
+func getInlineConfigForCluster(c *Cluster) *api.Config {
 	config := api.NewConfig()
 	config.Clusters[c.Name] = api.NewCluster()
 	config.Clusters[c.Name].Server = c.Server
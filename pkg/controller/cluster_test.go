@@ -2,8 +2,13 @@ package controller
 
 import (
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"net/http"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 var defaultCluster = Cluster{
@@ -33,3 +38,166 @@ func TestCluster_b64ToBytes(t *testing.T) {
 	b := b64ToBytes(str)
 	assert.Nil(t, b, "Expected b to be nil")
 }
+
+func TestConfig_Validate(t *testing.T) {
+	config := &Config{Clusters: []Cluster{defaultCluster, {Name: "b", Server: "https://b:6443", Token: "token"}}}
+	assert.NoError(t, config.Validate())
+
+	config = &Config{Clusters: []Cluster{{Server: "https://a:6443"}}}
+	assert.Error(t, config.Validate(), "Expected error for cluster without name")
+
+	config = &Config{Clusters: []Cluster{{Name: "a", Server: "https://a:6443"}, {Name: "a", Server: "https://a:6443"}}}
+	assert.Error(t, config.Validate(), "Expected error for duplicate cluster")
+
+	config = &Config{Clusters: []Cluster{
+		{Name: "a", Server: "a:6443"},
+		{Name: "b", Server: "https://b:6443", Ca: "not base64"},
+		{Name: "c", Server: "https://c:6443", Cert: defaultCluster.Cert},
+		{Name: "d", Server: "https://d:6443", Cert: defaultCluster.Cert, Key: defaultCluster.Key, Token: "token"},
+		{Name: "e", Server: "https://e:6443", Ca: defaultCluster.Ca, InsecureSkipTLSVerify: true},
+		{Name: "f"},
+	}}
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.Len(t, err.(utilerrors.Aggregate).Errors(), 6, "Expected all problems to be reported")
+
+	config = &Config{Sanitize: []SanitizeRule{
+		{Kind: "Widget", Paths: []string{"spec.nodeRef"}},
+		{Paths: []string{"spec..nodeRef"}},
+		{Kind: "Widget"},
+	}}
+	err = config.Validate()
+	assert.Error(t, err)
+	assert.Len(t, err.(utilerrors.Aggregate).Errors(), 3, "Expected all problems with sanitize rules to be reported")
+
+	config = &Config{Resources: []ResourceConfig{
+		{Resource: "deployments"},
+		{Resource: "services.v1.", Workers: -1},
+		{Resource: "pods.v1.", Workers: 4},
+		{Resource: "pods.v1."},
+		{Resource: "secrets.v1.", Resync: -time.Minute},
+	}, Resync: -time.Hour}
+	err = config.Validate()
+	assert.Error(t, err)
+	assert.Len(t, err.(utilerrors.Aggregate).Errors(), 5, "Expected all problems with resources to be reported")
+}
+
+func TestConfig_ValidateRetries(t *testing.T) {
+	config := &Config{Clusters: []Cluster{{Name: "a", Server: "https://a:6443", MaxRetries: 10, Backoff: time.Second, MaxBackoff: time.Minute}}}
+	assert.NoError(t, config.Validate())
+
+	config = &Config{DeadLetterInterval: -time.Minute, Clusters: []Cluster{
+		{Name: "a", Server: "https://a:6443", MaxRetries: -1},
+		{Name: "b", Server: "https://b:6443", Backoff: time.Minute, MaxBackoff: time.Second},
+	}}
+	err := config.Validate()
+	assert.Error(t, err)
+	assert.Len(t, err.(utilerrors.Aggregate).Errors(), 3, "Expected all problems with retries to be reported")
+}
+
+func TestConfig_workersFor(t *testing.T) {
+	config := &Config{Resources: []ResourceConfig{{Resource: "deployments.v1.apps", Workers: 2}, {Resource: "pods.v1."}}}
+	assert.Equal(t, 2, config.workersFor(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}))
+	assert.Equal(t, 0, config.workersFor(schema.GroupVersionResource{Version: "v1", Resource: "pods"}), "Expected no limit when workers is not set")
+	assert.Equal(t, 0, config.workersFor(schema.GroupVersionResource{Version: "v1", Resource: "services"}), "Expected no limit for resource without config")
+}
+
+func TestConfig_resyncFor(t *testing.T) {
+	config := &Config{Resync: time.Hour, Resources: []ResourceConfig{{Resource: "deployments.v1.apps", Resync: time.Minute}, {Resource: "pods.v1."}}}
+	assert.Equal(t, time.Minute, config.resyncFor(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}))
+	assert.Equal(t, time.Hour, config.resyncFor(schema.GroupVersionResource{Version: "v1", Resource: "pods"}), "Expected default when resync is not set")
+	assert.Equal(t, time.Duration(0), (&Config{}).resyncFor(schema.GroupVersionResource{Version: "v1", Resource: "pods"}), "Expected resyncs to be disabled by default")
+}
+
+func TestConfig_resyncCheckPeriod(t *testing.T) {
+	config := &Config{Resync: time.Hour, Resources: []ResourceConfig{{Resource: "deployments.v1.apps", Resync: time.Minute}, {Resource: "pods.v1."}}}
+	assert.Equal(t, time.Minute, config.resyncCheckPeriod())
+	config = &Config{Resources: []ResourceConfig{{Resource: "deployments.v1.apps", Resync: time.Minute}}}
+	assert.Equal(t, time.Minute, config.resyncCheckPeriod(), "Expected resyncs of a single resource to be checked")
+	assert.Equal(t, time.Duration(0), (&Config{}).resyncCheckPeriod())
+}
+
+func TestCluster_RESTConfigFromKubeconfig(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	err := ioutil.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev:6443
+- name: prod
+  cluster:
+    server: https://prod:6443
+users:
+- name: prod
+  user:
+    token: prod-token
+contexts:
+- name: dev
+  context:
+    cluster: dev
+- name: prod
+  context:
+    cluster: prod
+    user: prod
+current-context: dev
+`), 0600)
+	assert.NoError(t, err)
+
+	cluster := Cluster{Name: "prod", Kubeconfig: kubeconfig, Context: "prod"}
+	assert.Empty(t, cluster.validate(), "Unexpected validation errors")
+	config, err := cluster.RESTConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://prod:6443", config.Host, "Unexpected host")
+	assert.Equal(t, "prod-token", config.BearerToken, "Unexpected token")
+
+	cluster = Cluster{Name: "dev", Kubeconfig: kubeconfig, Server: "https://override:6443"}
+	config, err = cluster.RESTConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://override:6443", config.Host, "Expected server to be overridden")
+
+	cluster = Cluster{Name: "missing", Kubeconfig: kubeconfig, Context: "missing", Token: "token"}
+	assert.Len(t, cluster.validate(), 2, "Expected missing context and conflicting token to be reported")
+}
+
+func TestCluster_validateAuthProvider(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	err := ioutil.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod:6443
+users:
+- name: prod
+  user:
+    auth-provider:
+      name: unknown
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: prod
+current-context: prod
+`), 0600)
+	assert.NoError(t, err)
+
+	cluster := Cluster{Name: "prod", Kubeconfig: kubeconfig}
+	errs := cluster.validate()
+	assert.Len(t, errs, 1, "Expected auth provider that isn't registered to be reported")
+	assert.Contains(t, errs[0].Error(), "no Auth Provider found for name \"unknown\"")
+}
+
+func TestCluster_RESTConfigWithProxy(t *testing.T) {
+	cluster := Cluster{Name: "proxied", Server: "https://proxied:6443", Proxy: "http://proxy:3128"}
+	assert.Empty(t, cluster.validate(), "Unexpected validation errors")
+	config, err := cluster.RESTConfig()
+	assert.NoError(t, err)
+	assert.NotNil(t, config.WrapTransport, "Expected transport to be wrapped")
+
+	rt := config.WrapTransport(&http.Transport{})
+	req, _ := http.NewRequest("GET", "https://proxied:6443", nil)
+	proxy, err := rt.(*http.Transport).Proxy(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "proxy:3128", proxy.Host, "Unexpected proxy")
+}
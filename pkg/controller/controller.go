@@ -3,6 +3,8 @@ package controller
 import (
 	"context"
 	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -11,75 +13,218 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Controller is a k8s controller implementation
+// Controller syncs the resources of a single GroupVersionResource to the clusters. Controllers are created and
+// run by a Manager, which shares its workqueue and workers between them. The informer of a controller runs until
+// the controller is stopped
 type Controller struct {
-	queue    workqueue.RateLimitingInterface
-	factory  dynamicinformer.DynamicSharedInformerFactory
-	gvr      *schema.GroupVersionResource
-	indexer  cache.Indexer
-	clusters []Cluster
-	config   *Config
-}
-
-// New creates a new instance of controller for the given GroupVersionResource
-// See https://godoc.org/k8s.io/apimachinery/pkg/runtime/schema#GroupVersionResource for more information
-func New(client dynamic.Interface, config *Config, gvr *schema.GroupVersionResource) *Controller {
-	return &Controller{
-		factory: dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, v1.NamespaceAll, nil),
-		queue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "synka.io"),
-		gvr:     gvr,
-		config:  config,
-	}
-}
-
-// Run will set up the event handlers for types we are interested in, as well
-// as syncing informer caches and starting workers. It will block until stopCh channel
-// is closed, at which point it will shutdown the workqueue and wait for
-// workers to finish processing their current work items.
-func (c *Controller) Run(stopCh <-chan struct{}) {
-	defer runtime.HandleCrash()
-	defer c.queue.ShutDown()
-	informer := c.factory.ForResource(*c.gvr)
-	c.indexer = informer.Informer().GetIndexer()
-	go c.startWatching(stopCh, informer.Informer())
-
-	if !cache.WaitForCacheSync(stopCh, informer.Informer().HasSynced) {
-		runtime.HandleError(fmt.Errorf("Timed out waiting for caches to sync"))
-		return
+	queue      workqueue.RateLimitingInterface
+	client     dynamic.Interface
+	gvr        *schema.GroupVersionResource
+	informer   cache.SharedIndexInformer
+	indexer    cache.Indexer
+	clusters   *ClusterRegistry
+	sanitizers *SanitizerRegistry
+	config     *Config
+	recorder   record.EventRecorder
+	policies   *PolicyStore
+	retrier    *retrier
+	mu         sync.Mutex
+	deleted    map[string]*unstructured.Unstructured
+	changed    map[string]time.Time
+	synced     int32
+	running    int32
+	workers    int32
+	active     int32
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+	driftOnce  sync.Once
+}
+
+// newController creates the controller of the given GroupVersionResource along with its informer, using the
+// client, workqueue and settings of the manager m
+func newController(m *Manager, gvr schema.GroupVersionResource) *Controller {
+	informer := dynamicinformer.NewFilteredDynamicInformer(m.client, gvr, v1.NamespaceAll, m.config.resyncCheckPeriod(), cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil).Informer()
+	c := &Controller{
+		queue:      m.queue,
+		client:     m.client,
+		gvr:        &gvr,
+		informer:   informer,
+		indexer:    informer.GetIndexer(),
+		config:     m.config,
+		recorder:   m.recorder,
+		policies:   m.policies,
+		clusters:   m.clusters,
+		sanitizers: m.sanitizers,
+		retrier:    newRetrier(gvr.GroupResource().String()),
+		workers:    int32(m.config.workersFor(gvr)),
+		deleted:    make(map[string]*unstructured.Unstructured),
+		changed:    make(map[string]time.Time),
+		stopCh:     make(chan struct{}),
+	}
+	informer.AddEventHandlerWithResyncPeriod(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onAdd,
+		UpdateFunc: c.onUpdate,
+		DeleteFunc: c.onDelete,
+	}, m.config.resyncFor(gvr))
+	return c
+}
+
+// run starts syncing resources to clusters that are added, updated or reconciled at runtime, watching the clusters
+// for drift and retrying dead letters. It is called by the manager once the informer caches have synced and this
+// instance is leading, and returns right away. Everything it starts ends when the controller is stopped
+func (c *Controller) run() {
+	unregisterChange := c.clusters.OnChange(func(names []string) {
+		// Nothing needs to be synced to clusters that were removed
+		for _, name := range names {
+			if _, ok := c.clusters.Get(name); ok {
+				c.enqueueAll()
+				return
+			}
+		}
+	})
+	unregisterReconcile := c.clusters.OnReconcile(c.enqueueCluster)
+	go func() {
+		<-c.stopCh
+		unregisterChange()
+		unregisterReconcile()
+	}()
+
+	// Watch the resources in the clusters for drift if every resource is subject to it. Otherwise the clusters
+	// are only watched once a resource asks for it
+	if c.config.defaultDriftPolicy() != DriftIgnore {
+		c.watchDrift()
 	}
 
-	go wait.Until(c.runWorker, time.Second, stopCh)
+	// Periodically retry syncs that ran out of retries
+	go wait.Until(c.retryDeadLetters, c.config.deadLetterInterval(), c.stopCh)
+
+	atomic.StoreInt32(&c.running, 1)
+	klog.Infof("Started controller for %s", c.resource())
+}
+
+// watchDrift starts watching the resources in the clusters for drift, unless they are watched already. The
+// clusters are watched until the controller is stopped
+func (c *Controller) watchDrift() {
+	c.driftOnce.Do(func() {
+		klog.Infof("Watching %s in clusters for drift", c.resource())
+		go newDriftWatcher(*c.gvr, c.config, c.clusters, c.handleDrift).Run(c.stopCh)
+	})
+}
 
-	klog.Infof("Started controller for %s", c.gvr.GroupResource().String())
-	<-stopCh
-	klog.Infof("Shutting down controller for %s", c.gvr.GroupResource().String())
+// isRunning returns true once run has been called
+func (c *Controller) isRunning() bool {
+	return atomic.LoadInt32(&c.running) == 1
+}
 
+// stop stops the informer and everything started by run. Work items of the resource that are still queued are
+// dropped by the manager
+func (c *Controller) stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+		klog.Infof("Shutting down controller for %s", c.resource())
+	})
 }
 
-func (c *Controller) runWorker() {
-	for c.processNextItem() {
+// acquire reserves one of the workers of the controller. Returns false if as many resources as the controller is
+// limited to are already being synced
+func (c *Controller) acquire() bool {
+	if atomic.AddInt32(&c.active, 1) > c.workers && c.workers > 0 {
+		atomic.AddInt32(&c.active, -1)
+		return false
 	}
+	return true
 }
 
-func (c *Controller) processNextItem() bool {
-	key, quit := c.queue.Get()
-	if quit {
+// release frees a worker reserved with acquire
+func (c *Controller) release() {
+	atomic.AddInt32(&c.active, -1)
+}
+
+// stopped returns true once the controller is stopped
+func (c *Controller) stopped() bool {
+	select {
+	case <-c.stopCh:
+		return true
+	default:
 		return false
 	}
+}
 
-	defer c.queue.Done(key)
+// newItem returns the work item that syncs the resource with the given key to cluster, or to all of its clusters
+// if cluster is empty
+func (c *Controller) newItem(key, cluster string) workItem {
+	return workItem{gvr: *c.gvr, key: key, cluster: cluster}
+}
 
-	err := c.syncToStdout(key.(string))
-	c.handleErr(err, key)
-	return true
+// HasSynced returns true once the informer caches of the controller have synced
+func (c *Controller) HasSynced() bool {
+	return atomic.LoadInt32(&c.synced) == 1
+}
+
+// enqueueAll adds every resource in the cache to the queue
+func (c *Controller) enqueueAll() {
+	for _, key := range c.indexer.ListKeys() {
+		c.queue.Add(c.newItem(key, ""))
+	}
+}
+
+// enqueueCluster adds every resource in the cache to the queue to be synced to the cluster with the given name
+// only. Resources that don't select the cluster are skipped when they are synced
+func (c *Controller) enqueueCluster(name string) {
+	for _, key := range c.indexer.ListKeys() {
+		c.queue.Add(c.newItem(key, name))
+	}
+}
+
+// enqueueNamespace adds every resource in the cache that is in the given namespace to the queue
+func (c *Controller) enqueueNamespace(namespace string) {
+	objs, err := c.indexer.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, obj := range objs {
+		if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			c.queue.Add(c.newItem(key, ""))
+		}
+	}
+}
+
+// DeadLetters returns the syncs of resources to clusters that the controller gave up on until they are retried
+func (c *Controller) DeadLetters() []DeadLetter {
+	return c.retrier.deadLetters()
+}
+
+// retryDeadLetters adds the dead letters to the queue
+func (c *Controller) retryDeadLetters() {
+	for _, item := range c.retrier.revive() {
+		klog.V(2).Infof("Retrying dead letter %s on %s", item.key, item.cluster)
+		c.queue.Add(item)
+	}
+}
+
+// process syncs the resource of a work item taken from the queue, and retries it if that fails
+func (c *Controller) process(item workItem) {
+	start := time.Now()
+	err := c.syncToStdout(item)
+	reconcileDuration.WithLabelValues(c.resource()).Observe(time.Since(start).Seconds())
+	c.handleErr(err, item)
 }
 
-func (c *Controller) syncToStdout(key string) error {
+// syncToStdout syncs the resource of the work item to the clusters it selects, or only to the cluster of the
+// work item if it has one. Failed syncs are retried per cluster
+func (c *Controller) syncToStdout(item workItem) error {
+	key := item.key
 
 	obj, exists, err := c.indexer.GetByKey(key)
 	if err != nil {
@@ -90,102 +235,518 @@ func (c *Controller) syncToStdout(key string) error {
 	// Handle deletes
 	if !exists {
 		klog.V(4).Infof("Resource %s does not exists anymore", key)
+		return c.syncDelete(item)
+	}
+	c.forgetDeleted(key)
+
+	// Work on a copy so that the object in the informer cache, which is shared with other handlers, is never modified
+	u := obj.(*unstructured.Unstructured).DeepCopy()
+
+	// Create a sync config. Resources with an invalid configuration are left alone until it is fixed
+	sc, policy, err := c.syncConfigFor(u)
+	if err != nil {
+		c.invalidSyncConfig(u, err)
+		sc.Sync = false
+	}
+
+	// Keep track of the clusters that the resource is in sync on
+	var synced []string
+	if c.policies != nil {
+		defer func() {
+			c.policies.Observe(c.policyKey(key), policy, synced)
+		}()
+	}
+
+	// Only go any further if object is annotated properly
+	if !sc.Sync {
+		c.retrier.forgetKey(key)
+		c.forgetChanged(key)
 		return nil
 	}
+	if c.driftPolicyFor(sc) != DriftIgnore {
+		c.watchDrift()
+	}
 
-	// Loop through the list of clusters and create the resource on each of them
-	u := obj.(*unstructured.Unstructured)
-	for _, cluster := range c.config.Clusters {
+	// Create the resource on each of the selected clusters in parallel, so that a slow or failing cluster
+	// doesn't hold up the others
+	selected := c.selectClusters(u, sc)
+	clusters := c.targetClusters(item, selected)
+	ops := make([]string, len(clusters))
+	results := make([]error, len(clusters))
+	var wg sync.WaitGroup
+	for i := range clusters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ops[i], results[i] = c.syncCluster(key, u, sc, clusters[i])
+		}(i)
+	}
+	wg.Wait()
 
-		// Create a sync config
-		sc := NewSyncConfigFrom(u.GetAnnotations())
+	statuses := make(map[string]ClusterStatus)
+	for i, cluster := range clusters {
+		statuses[cluster.Name] = c.recordResult(u, cluster.Name, ops[i], results[i])
+		c.retry(c.newItem(key, cluster.Name), cluster, results[i])
+	}
 
-		// Only go any further if object is annotated properly
-		if sc.Sync {
+	// The resource is in sync on the selected clusters that it isn't failing on
+	failing := c.retrier.failingClusters(key)
+	for _, cluster := range selected {
+		if !failing[cluster.Name] {
+			synced = append(synced, cluster.Name)
+		}
+	}
+	if len(failing) == 0 {
+		c.forgetChanged(key)
+	}
 
-			// Remove any immutable fields
-			delete(u.Object["metadata"].(map[string]interface{}), "resourceVersion")
-			delete(u.Object["metadata"].(map[string]interface{}), "uid")
+	if c.config.StatusAnnotation {
+		if err := c.writeStatus(u, selected, statuses); err != nil {
+			return fmt.Errorf("error writing status: %v", err)
+		}
+	}
+	return nil
+}
 
-			// Get a client for the GroupVersionResource
-			client, err := cluster.GetClient(c.gvr)
-			if err != nil {
-				return err
-			}
+// targetClusters returns the clusters of selected that the work item syncs to. Retries for clusters that are
+// no longer selected are forgotten
+func (c *Controller) targetClusters(item workItem, selected []Cluster) []Cluster {
+	if item.cluster == "" {
+		return selected
+	}
+	for _, cluster := range selected {
+		if cluster.Name == item.cluster {
+			return []Cluster{cluster}
+		}
+	}
+	c.retrier.forget(item)
+	return nil
+}
 
-			// Check to see if the resource already exists
-			result, err := updateOrCreate(client, c.gvr, u, !sc.SkipExisting)
-			if err != nil {
-				return err
-			}
+// retry schedules a retry of a failed sync of a resource to cluster, or makes it a dead letter once the cluster
+// allows no more retries. Earlier failures are forgotten if err is nil
+func (c *Controller) retry(item workItem, cluster Cluster, err error) {
+	if err == nil {
+		c.retrier.forget(item)
+		return
+	}
+	if delay, ok := c.retrier.failed(item, cluster, err); ok {
+		klog.Infof("Error syncing resource %s to %s, retrying in %s: %v", item.key, cluster.Name, delay, err)
+		c.queue.AddAfter(item, delay)
+		return
+	}
+	klog.Infof("Giving up syncing resource %s to %s until dead letters are retried: %v", item.key, cluster.Name, err)
+}
+
+// syncCluster writes the resource u with the given key to cluster using the strategy of the sync config,
+// and returns the result of the write. The write is abandoned if it takes longer than the timeout of the cluster
+func (c *Controller) syncCluster(key string, u *unstructured.Unstructured, sc SyncConfig, cluster Cluster) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cluster.timeout())
+	defer cancel()
+
+	// Create the resource as it should look like in the cluster
+	o := c.transform(u, cluster)
+
+	// Get a client for the cluster
+	client, err := c.clusters.Clients().Get(cluster)
+	if err != nil {
+		return "", newTargetError(cluster.Name, err)
+	}
+
+	// Write the resource using the strategy of the sync config
+	var result *unstructured.Unstructured
+	var op string
+	strategy := sc.Strategy
+	if strategy == "" {
+		strategy = c.config.defaultStrategy()
+	}
+	switch strategy {
+	case StrategyApply:
+		result, op, err = apply(ctx, client, c.gvr, o, !sc.SkipExisting, sc.Adopt, sc.Force)
+	case StrategyMerge:
+		result, op, err = merge(ctx, client, c.gvr, o, !sc.SkipExisting, sc.Adopt)
+	default:
+		result, op, err = updateOrCreate(ctx, client, c.gvr, o, !sc.SkipExisting, sc.Adopt)
+	}
+	c.clusters.Clients().Observe(cluster.Name, err)
+	if oerr, ok := err.(*OwnershipError); ok {
+		oerr.Cluster = cluster.Name
+	}
+	if err != nil {
+		return "", newTargetError(cluster.Name, err)
+	}
+
+	klog.V(2).Infof("Synced %s/%s/%s on %s", u.GetAPIVersion(), result.GetKind(), result.GetName(), cluster.Name)
+	c.observeLag(key, cluster.Name)
+	c.clusters.ObserveSync(cluster.Name)
+	return op, nil
+}
+
+// transform returns the resource u as it should be written to cluster. The result is a copy of u without
+// cluster specific fields that is stamped with ownership markers. u itself is left untouched.
+func (c *Controller) transform(u *unstructured.Unstructured, cluster Cluster) *unstructured.Unstructured {
+	o := u.DeepCopy()
+	c.sanitizers.Sanitize(o)
+	setOwnership(o, u, c.config)
+	return o
+}
+
+// syncConfigFor returns the sync config of the resource u along with the name of the policy that it was created from.
+// Annotations on the resource take precedence over policies, and the policy name is empty if no policy applies.
+// Returns an error if the annotations or the policy that apply to the resource are invalid
+func (c *Controller) syncConfigFor(u *unstructured.Unstructured) (SyncConfig, string, error) {
+	sc, err := NewSyncConfigFrom(u.GetAnnotations())
+	if _, ok := u.GetAnnotations()[syncAnnotationKey]; ok || c.policies == nil {
+		return sc, "", err
+	}
+
+	policy := c.policies.Match(c.gvr, u)
+	if policy == nil {
+		return sc, "", nil
+	}
+
+	psc, err := NewSyncConfigFromPolicy(policy)
+	if err != nil {
+		return sc, "", err
+	}
+	return psc, policy.Name, nil
+}
+
+// invalidSyncConfig reports a sync config that isn't valid on the resource u
+func (c *Controller) invalidSyncConfig(u *unstructured.Unstructured, err error) {
+	msg := fmt.Sprintf("Resource has an invalid sync configuration: %v", err)
+	klog.Infof("%s/%s/%s: %s", u.GetAPIVersion(), u.GetKind(), u.GetName(), msg)
+	c.recorder.Event(u, corev1.EventTypeWarning, reasonInvalidConfig, msg)
+}
+
+// policyKey returns a key that identifies the resource with the given key across all controllers
+func (c *Controller) policyKey(key string) string {
+	return fmt.Sprintf("%s/%s", c.gvr.GroupResource().String(), key)
+}
+
+// selectClusters returns the clusters that the resource u should be synced to. Unknown
+// cluster names and invalid cluster selectors referenced by the sync config are reported on the resource.
+func (c *Controller) selectClusters(u *unstructured.Unstructured, sc SyncConfig) []Cluster {
+	clusters, unknown, err := selectClusters(sc, c.clusters.List())
+	if err != nil {
+		msg := fmt.Sprintf("Resource has an invalid cluster selector: %v", err)
+		klog.Infof("%s/%s/%s: %s", u.GetAPIVersion(), u.GetKind(), u.GetName(), msg)
+		c.recorder.Event(u, corev1.EventTypeWarning, reasonInvalidSelector, msg)
+		return nil
+	}
+	if len(unknown) > 0 {
+		msg := fmt.Sprintf("Resource references unknown clusters %s", strings.Join(unknown, ","))
+		klog.Infof("%s/%s/%s: %s", u.GetAPIVersion(), u.GetKind(), u.GetName(), msg)
+		c.recorder.Event(u, corev1.EventTypeWarning, reasonUnknownCluster, msg)
+	}
+	return clusters
+}
+
+// syncDelete removes the last known state of a deleted resource from each of the clusters.
+// Resources annotated with synka.io/orphan are left untouched in the clusters.
+func (c *Controller) syncDelete(item workItem) error {
+	key := item.key
+	u := c.getDeleted(key)
+	if u == nil {
+		c.retrier.forgetKey(key)
+		return nil
+	}
 
-			klog.V(2).Infof("Synced %s/%s/%s on %s", u.GetAPIVersion(), result.GetKind(), result.GetName(), cluster.Name)
+	if c.policies != nil {
+		c.policies.Observe(c.policyKey(key), "", nil)
+	}
+
+	// The strategy and drift policy don't matter to deletes, so they are removed even if those are invalid
+	sc, _, _ := c.syncConfigFor(u)
+	if !sc.Sync || sc.Orphan {
+		c.retrier.forgetKey(key)
+		c.forgetDeleted(key)
+		c.forgetChanged(key)
+		return nil
+	}
+
+	// Only resources carrying the ownership markers of the deleted resource are removed
+	owner := u.DeepCopy()
+	setOwnership(owner, u, c.config)
+
+	// Delete the resource from each of the selected clusters in parallel
+	clusters := c.targetClusters(item, c.selectClusters(u, sc))
+	results := make([]error, len(clusters))
+	var wg sync.WaitGroup
+	for i := range clusters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.deleteCluster(key, u, owner, clusters[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, cluster := range clusters {
+		err := results[i]
+		if oerr, ok := err.(*OwnershipError); ok {
+			c.recorder.Event(u, corev1.EventTypeWarning, reasonConflict, oerr.Error())
+			klog.Infof("Not deleting resource %s: %v", key, oerr)
+			err = nil
 		}
+		if err != nil {
+			syncsTotal.WithLabelValues(c.resource(), cluster.Name, resultFailed).Inc()
+			c.observeError(cluster.Name, err)
+		}
+		c.retry(c.newItem(key, cluster.Name), cluster, err)
 	}
 
+	// Keep the last known state of the resource until it is deleted from every cluster
+	if len(c.retrier.failingClusters(key)) == 0 {
+		c.forgetDeleted(key)
+		c.forgetChanged(key)
+	}
 	return nil
 }
 
-// updateOrCreate will do a get on the given resource and if it doesn't exists then it will be created.
-// If the get returns something then it will update it instead.
-func updateOrCreate(client dynamic.Interface, gvr *schema.GroupVersionResource, u *unstructured.Unstructured, replace bool) (*unstructured.Unstructured, error) {
+// deleteCluster deletes the resource u with the given key from cluster if it carries the ownership markers of owner.
+// The delete is abandoned if it takes longer than the timeout of the cluster
+func (c *Controller) deleteCluster(key string, u, owner *unstructured.Unstructured, cluster Cluster) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cluster.timeout())
+	defer cancel()
+
+	// Get a client for the cluster
+	client, err := c.clusters.Clients().Get(cluster)
+	if err != nil {
+		return newTargetError(cluster.Name, err)
+	}
+
+	deleted, err := deleteIfOwned(ctx, client, c.gvr, owner)
+	c.clusters.Clients().Observe(cluster.Name, err)
+	if oerr, ok := err.(*OwnershipError); ok {
+		oerr.Cluster = cluster.Name
+	}
+	if err != nil {
+		return newTargetError(cluster.Name, err)
+	}
+
+	if deleted {
+		klog.V(2).Infof("Deleted %s/%s/%s on %s", u.GetAPIVersion(), u.GetKind(), u.GetName(), cluster.Name)
+		syncsTotal.WithLabelValues(c.resource(), cluster.Name, resultDeleted).Inc()
+		c.observeLag(key, cluster.Name)
+	}
+	return nil
+}
+
+// deleteIfOwned deletes the given resource from a cluster, but only if it carries the same ownership markers as u.
+// Returns true if the resource was deleted.
+func deleteIfOwned(ctx context.Context, client dynamic.Interface, gvr *schema.GroupVersionResource, u *unstructured.Unstructured) (bool, error) {
+
+	// Nothing to do if the resource doesn't exist
+	result, err := client.Resource(*gvr).Namespace(u.GetNamespace()).Get(ctx, u.GetName(), v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Leave resources that synka didn't create alone
+	if !isOwned(result, u, true) {
+		return false, &OwnershipError{Namespace: u.GetNamespace(), Name: u.GetName()}
+	}
+
+	// Make sure that we delete the exact resource we inspected
+	uid := result.GetUID()
+	propagation := v1.DeletePropagationBackground
+	err = client.Resource(*gvr).Namespace(u.GetNamespace()).Delete(ctx, u.GetName(), v1.DeleteOptions{
+		Preconditions:     &v1.Preconditions{UID: &uid},
+		PropagationPolicy: &propagation,
+	})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// setDeleted stores the last known state of a deleted resource so that it can be removed from the clusters
+func (c *Controller) setDeleted(key string, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deleted[key] = u
+}
+
+// getDeleted returns the last known state of a deleted resource, or nil if there is none
+func (c *Controller) getDeleted(key string) *unstructured.Unstructured {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deleted[key]
+}
+
+// forgetDeleted removes the last known state of a deleted resource
+func (c *Controller) forgetDeleted(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.deleted, key)
+}
+
+// setChanged records the time that a change to the resource with the given key was seen by the informer,
+// unless an earlier change is still waiting to be synced
+func (c *Controller) setChanged(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.changed[key]; !ok {
+		c.changed[key] = time.Now()
+	}
+}
+
+// forgetChanged removes the time of the pending change to the resource with the given key
+func (c *Controller) forgetChanged(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.changed, key)
+}
+
+// observeLag records the time between a pending change to the resource with the given key and it being written to cluster
+func (c *Controller) observeLag(key string, cluster string) {
+	c.mu.Lock()
+	changed, ok := c.changed[key]
+	c.mu.Unlock()
+	if ok {
+		syncLag.WithLabelValues(c.resource(), cluster).Set(time.Since(changed).Seconds())
+	}
+}
+
+// observeError records the class of an error returned when writing to the named cluster
+func (c *Controller) observeError(cluster string, err error) {
+	if terr, ok := err.(*TargetError); ok {
+		syncErrorsTotal.WithLabelValues(c.resource(), cluster, string(terr.Class)).Inc()
+	}
+}
+
+// resource returns the name of the resource that the controller syncs, as used in metrics
+func (c *Controller) resource() string {
+	return c.gvr.GroupResource().String()
+}
 
+// updateOrCreate will do a get on the given resource and if it doesn't exists then it will be created.
+// If the get returns something then it will update it instead, but only if the existing resource is
+// owned by synka or adopt is true. Updates that conflict with a concurrent change, and creates that race with
+// someone else, are retried with the latest version of the resource. Returns the written resource along with
+// the result of the write.
+func updateOrCreate(ctx context.Context, client dynamic.Interface, gvr *schema.GroupVersionResource, u *unstructured.Unstructured, replace bool, adopt bool) (*unstructured.Unstructured, string, error) {
 	var result *unstructured.Unstructured
+	var op string
+	err := retry.OnError(retry.DefaultRetry, isConflict, func() error {
+		var err error
+		result, op, err = tryUpdateOrCreate(ctx, client, gvr, u, replace, adopt)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return result, op, nil
+}
 
-	// Get the resource to see if it already exits. Errors are ignored here but handled later on when creating/updating
-	result, _ = client.Resource(*gvr).Namespace(u.GetNamespace()).Get(context.Background(), u.GetName(), v1.GetOptions{})
+// tryUpdateOrCreate makes a single attempt at updateOrCreate
+func tryUpdateOrCreate(ctx context.Context, client dynamic.Interface, gvr *schema.GroupVersionResource, u *unstructured.Unstructured, replace bool, adopt bool) (*unstructured.Unstructured, string, error) {
 
-	// Create the resource if the get returns nil
-	if result == nil {
-		return client.Resource(*gvr).Namespace(u.GetNamespace()).Create(context.Background(), u, v1.CreateOptions{})
+	// Get the resource to see if it already exits, and create it if it doesn't
+	result, err := client.Resource(*gvr).Namespace(u.GetNamespace()).Get(ctx, u.GetName(), v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		result, err := client.Resource(*gvr).Namespace(u.GetNamespace()).Create(ctx, u, v1.CreateOptions{})
+		if err != nil {
+			return nil, "", err
+		}
+		return result, resultCreated, nil
+	}
+	if err != nil {
+		return nil, "", err
 	}
 
 	// Update existing resource if the get returns data and if replace is true
 	if replace {
-		return client.Resource(*gvr).Namespace(u.GetNamespace()).Update(context.Background(), u, v1.UpdateOptions{})
+		if !adopt && !isAdoptable(result) && !isOwned(result, u, false) {
+			return nil, "", &OwnershipError{Namespace: u.GetNamespace(), Name: u.GetName()}
+		}
+
+		// Update the version that was inspected, so that concurrent changes are detected
+		existing := result.GetResourceVersion()
+		o := u.DeepCopy()
+		o.SetResourceVersion(existing)
+		result, err := client.Resource(*gvr).Namespace(u.GetNamespace()).Update(ctx, o, v1.UpdateOptions{})
+		if err != nil {
+			return nil, "", err
+		}
+		// The API server keeps the resource version of updates that don't change anything
+		if existing != "" && result.GetResourceVersion() == existing {
+			return result, resultUnchanged, nil
+		}
+		return result, resultUpdated, nil
 	}
 
-	return result, nil
+	return result, resultSkipped, nil
+}
+
+// isConflict returns true if err is caused by a concurrent change to a resource
+func isConflict(err error) bool {
+	return errors.IsConflict(err) || errors.IsAlreadyExists(err)
 }
 
-// handleErr
-func (c *Controller) handleErr(err error, key interface{}) {
+// handleErr retries work items that failed for other reasons than a failed sync to a cluster, such as writing
+// the status of a resource. Failed syncs to clusters are retried per cluster by syncToStdout
+func (c *Controller) handleErr(err error, item workItem) {
 	if err == nil {
-		c.queue.Forget(key)
+		c.queue.Forget(item)
 		return
 	}
-	if c.queue.NumRequeues(key) < 5 {
-		klog.Infof("Error syncing resource %s: %v", key, err)
-		c.queue.AddRateLimited(key)
+	if c.queue.NumRequeues(item) < 5 {
+		klog.Infof("Error syncing resource %s: %v", item.key, err)
+		c.queue.AddRateLimited(item)
 		return
 	}
-	c.queue.Forget(key)
+	c.queue.Forget(item)
 	runtime.HandleError(err)
-	klog.Infof("Dropping resource %s out of the queue: %v", key, err)
+	klog.Infof("Dropping resource %s out of the queue: %v", item.key, err)
 }
 
-func (c *Controller) startWatching(stopCh <-chan struct{}, s cache.SharedIndexInformer) {
-	handlers := cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(obj)
-			if err == nil {
-				c.queue.Add(key)
-			}
-		},
-		UpdateFunc: func(old, new interface{}) {
-			key, err := cache.MetaNamespaceKeyFunc(new)
-			if err == nil {
-				c.queue.Add(key)
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-			if err == nil {
-				c.queue.Add(key)
-			}
-		},
+// onAdd queues a resource that was added to the informer cache
+func (c *Controller) onAdd(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err == nil {
+		c.setChanged(key)
+		c.queue.Add(c.newItem(key, ""))
+	}
+}
+
+// onUpdate queues a resource that was updated in the informer cache, unless only its status annotation changed
+func (c *Controller) onUpdate(old, new interface{}) {
+	if onlyStatusChanged(old, new) {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(new)
+	if err != nil {
+		return
+	}
+	// Periodic resyncs deliver the unchanged resource, which is synced again but isn't a change
+	if !isResync(old, new) {
+		c.setChanged(key)
 	}
+	c.queue.Add(c.newItem(key, ""))
+}
 
-	s.AddEventHandler(handlers)
-	s.Run(stopCh)
+// onDelete queues a resource that was deleted from the informer cache
+func (c *Controller) onDelete(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err == nil {
+		c.setDeleted(key, obj)
+		c.setChanged(key)
+		c.queue.Add(c.newItem(key, ""))
+	}
 }
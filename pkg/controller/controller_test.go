@@ -1 +1,205 @@
 package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"sync"
+	"testing"
+)
+
+var configMapGVR = &schema.GroupVersionResource{
+	Group:    "",
+	Version:  "v1",
+	Resource: "configmaps",
+}
+
+func newConfigMap(name string, labels map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("ConfigMap")
+	u.SetNamespace("default")
+	u.SetName(name)
+	u.SetLabels(labels)
+	return u
+}
+
+func TestController_deleteIfOwned(t *testing.T) {
+	config := &Config{Name: "source"}
+	source := newConfigMap("cm", nil)
+	source.SetUID("1234")
+
+	owned := source.DeepCopy()
+	setOwnership(owned, source, config)
+	foreign := newConfigMap("foreign", nil)
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), owned, foreign)
+
+	deleted, err := deleteIfOwned(context.Background(), client, configMapGVR, owned)
+	assert.NoError(t, err)
+	assert.True(t, deleted, "Expected owned resource to be deleted")
+
+	owner := foreign.DeepCopy()
+	setOwnership(owner, foreign, config)
+	deleted, err = deleteIfOwned(context.Background(), client, configMapGVR, owner)
+	assert.IsType(t, &OwnershipError{}, err)
+	assert.False(t, deleted, "Expected foreign resource to be left alone")
+	_, err = client.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "foreign", v1.GetOptions{})
+	assert.NoError(t, err)
+
+	deleted, err = deleteIfOwned(context.Background(), client, configMapGVR, newConfigMap("missing", nil))
+	assert.NoError(t, err)
+	assert.False(t, deleted, "Expected missing resource not to be deleted")
+}
+
+func TestController_updateOrCreate(t *testing.T) {
+	config := &Config{Name: "source"}
+	foreign := newConfigMap("cm", nil)
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), foreign)
+
+	desired := newConfigMap("cm", map[string]string{"app": "test"})
+	setOwnership(desired, desired, config)
+
+	_, _, err := updateOrCreate(context.Background(), client, configMapGVR, desired, true, false)
+	assert.IsType(t, &OwnershipError{}, err)
+
+	result, _, err := updateOrCreate(context.Background(), client, configMapGVR, desired, false, false)
+	assert.NoError(t, err)
+	assert.Empty(t, result.GetLabels(), "Expected existing resource to be left alone")
+
+	result, _, err = updateOrCreate(context.Background(), client, configMapGVR, desired, true, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", result.GetLabels()["app"], "Expected adopted resource to be updated")
+
+	result, _, err = updateOrCreate(context.Background(), client, configMapGVR, desired, true, false)
+	assert.NoError(t, err)
+	assert.Equal(t, managedByLabelValue, result.GetLabels()[managedByLabelKey], "Expected owned resource to be updated")
+}
+
+func TestController_setDeleted(t *testing.T) {
+	c := NewManager(nil, record.NewFakeRecorder(10), nil, NewClusterRegistry(nil), NewSanitizerRegistry(nil), &Config{}).Add(*configMapGVR)
+	u := newConfigMap("cm", nil)
+
+	c.setDeleted("default/cm", cache.DeletedFinalStateUnknown{Key: "default/cm", Obj: u})
+	assert.Equal(t, u, c.getDeleted("default/cm"), "Expected tombstone to be unwrapped")
+
+	c.forgetDeleted("default/cm")
+	assert.Nil(t, c.getDeleted("default/cm"), "Expected tombstone to be forgotten")
+}
+
+func TestController_syncDeleteOrphan(t *testing.T) {
+	c := NewManager(nil, record.NewFakeRecorder(10), nil, NewClusterRegistry([]Cluster{defaultCluster}), NewSanitizerRegistry(nil), &Config{}).Add(*configMapGVR)
+	u := newConfigMap("cm", nil)
+	u.SetAnnotations(map[string]string{
+		syncAnnotationKey:   "true",
+		orphanAnnotationKey: "true",
+	})
+
+	c.setDeleted("default/cm", u)
+	assert.NoError(t, c.syncDelete(workItem{key: "default/cm"}))
+	assert.Nil(t, c.getDeleted("default/cm"), "Expected tombstone to be forgotten")
+}
+
+// setClient makes p return client for cluster
+func setClient(p *ClientPool, cluster Cluster, client dynamic.Interface) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clients[cluster.Name] = &pooledClient{cluster: cluster, client: client, health: ClusterHealth{Healthy: true}}
+}
+
+func TestController_syncToStdoutLeavesCacheUntouched(t *testing.T) {
+	registry := NewClusterRegistry([]Cluster{defaultCluster})
+	setClient(registry.Clients(), defaultCluster, fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	c := NewManager(nil, record.NewFakeRecorder(10), nil, registry, NewSanitizerRegistry(nil), &Config{Name: "source"}).Add(*configMapGVR)
+
+	u := newConfigMap("cm", map[string]string{"app": "test"})
+	u.SetAnnotations(map[string]string{syncAnnotationKey: "true"})
+	u.SetUID("1234")
+	u.SetResourceVersion("1")
+	u.Object["data"] = map[string]interface{}{"key": "value"}
+	u.Object["status"] = map[string]interface{}{"phase": "Active"}
+	c.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, c.indexer.Add(u))
+	expected := u.DeepCopy()
+
+	// Read the cached object concurrently, like other handlers of the informer would
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				obj, _, _ := c.indexer.GetByKey("default/cm")
+				cached := obj.(*unstructured.Unstructured)
+				_ = cached.GetResourceVersion()
+				_ = cached.GetLabels()
+				_, _, _ = unstructured.NestedMap(cached.Object, "status")
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, c.syncToStdout(workItem{key: "default/cm"}))
+	}
+	wg.Wait()
+
+	obj, _, _ := c.indexer.GetByKey("default/cm")
+	assert.Equal(t, expected, obj, "Expected cached object to be unchanged")
+
+	client, _ := registry.Clients().Get(defaultCluster)
+	result, err := client.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "cm", v1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.GetUID(), "Expected synced resource to be sanitized")
+	assert.Equal(t, managedByLabelValue, result.GetLabels()[managedByLabelKey], "Expected synced resource to be owned")
+}
+
+func TestController_syncToStdoutFansOut(t *testing.T) {
+	broken := Cluster{Name: "broken"}
+	registry := NewClusterRegistry([]Cluster{broken, defaultCluster})
+	failing := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	failing.PrependReactor("*", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+	setClient(registry.Clients(), broken, failing)
+	setClient(registry.Clients(), defaultCluster, fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	c := NewManager(nil, record.NewFakeRecorder(10), nil, registry, NewSanitizerRegistry(nil), &Config{}).Add(*configMapGVR)
+	c.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+	u := newConfigMap("cm", nil)
+	u.SetAnnotations(map[string]string{syncAnnotationKey: "true"})
+	assert.NoError(t, c.indexer.Add(u))
+	assert.NoError(t, c.syncToStdout(workItem{key: "default/cm"}))
+	assert.Equal(t, map[string]bool{"broken": true}, c.retrier.failingClusters("default/cm"), "Expected broken cluster to be retried")
+
+	// The resource is synced to the healthy cluster regardless
+	client, _ := registry.Clients().Get(defaultCluster)
+	_, err := client.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "cm", v1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestController_syncToStdoutInvalidConfig(t *testing.T) {
+	registry := NewClusterRegistry([]Cluster{defaultCluster})
+	setClient(registry.Clients(), defaultCluster, fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	recorder := record.NewFakeRecorder(10)
+	c := NewManager(nil, recorder, nil, registry, NewSanitizerRegistry(nil), &Config{}).Add(*configMapGVR)
+	c.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+	u := newConfigMap("cm", nil)
+	u.SetAnnotations(map[string]string{syncAnnotationKey: "true", strategyAnnotationKey: "aply"})
+	assert.NoError(t, c.indexer.Add(u))
+	assert.NoError(t, c.syncToStdout(workItem{key: "default/cm"}))
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning InvalidConfig Resource has an invalid sync configuration: Annotation synka.io/strategy")
+
+	// The resource isn't synced until its configuration is fixed
+	client, _ := registry.Clients().Get(defaultCluster)
+	_, err := client.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "cm", v1.GetOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var deadLettersGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "dead_letters",
+	Help:      "Number of resources that synka gave up syncing to a cluster until the dead letters are retried.",
+}, []string{"resource", "cluster"})
+
+func init() {
+	prometheus.MustRegister(deadLettersGauge)
+}
+
+// workItem is an item in the workqueue shared by all controllers, identifying a resource by its GroupVersionResource
+// and namespace/name key. Items without a cluster sync the resource to all of its clusters, while items with a
+// cluster sync it to that cluster only
+type workItem struct {
+	gvr     schema.GroupVersionResource
+	key     string
+	cluster string
+}
+
+// DeadLetter is a sync of a resource to a cluster that failed more times than the cluster allows, or that failed
+// with an error that retrying won't fix. Dead letters are retried periodically
+type DeadLetter struct {
+	Resource string    `json:"resource"`
+	Key      string    `json:"key"`
+	Cluster  string    `json:"cluster"`
+	Error    string    `json:"error"`
+	Retries  int       `json:"retries"`
+	Since    time.Time `json:"since"`
+}
+
+// retrier schedules retries of failed syncs of resources to clusters using the retry settings of each cluster,
+// and keeps the syncs that ran out of retries as dead letters. A retrier is safe for concurrent use.
+type retrier struct {
+	mu       sync.Mutex
+	resource string
+	clusters map[string]Cluster
+	limiters map[string]workqueue.RateLimiter
+	failing  map[workItem]bool
+	dead     map[workItem]DeadLetter
+}
+
+// newRetrier creates a retrier for syncs of the given resource
+func newRetrier(resource string) *retrier {
+	return &retrier{
+		resource: resource,
+		clusters: make(map[string]Cluster),
+		limiters: make(map[string]workqueue.RateLimiter),
+		failing:  make(map[workItem]bool),
+		dead:     make(map[workItem]DeadLetter),
+	}
+}
+
+// failed records a failed sync of a resource to cluster, and returns the delay before the sync should be retried.
+// Returns false if the sync became a dead letter instead
+func (r *retrier) failed(item workItem, cluster Cluster, err error) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limiter := r.limiterFor(cluster)
+	r.failing[item] = true
+	retries := limiter.NumRequeues(item)
+	if !isPermanent(err) && retries < cluster.maxRetries() {
+		return limiter.When(item), true
+	}
+
+	limiter.Forget(item)
+	if _, ok := r.dead[item]; !ok {
+		deadLettersGauge.WithLabelValues(r.resource, item.cluster).Inc()
+	}
+	r.dead[item] = DeadLetter{
+		Resource: r.resource,
+		Key:      item.key,
+		Cluster:  item.cluster,
+		Error:    err.Error(),
+		Retries:  retries,
+		Since:    time.Now(),
+	}
+	return 0, false
+}
+
+// limiterFor returns the rate limiter of cluster, replacing it if the retry settings of the cluster changed
+func (r *retrier) limiterFor(cluster Cluster) workqueue.RateLimiter {
+	limiter, ok := r.limiters[cluster.Name]
+	previous := r.clusters[cluster.Name]
+	if !ok || previous.Backoff != cluster.Backoff || previous.MaxBackoff != cluster.MaxBackoff {
+		limiter = cluster.rateLimiter()
+		r.limiters[cluster.Name] = limiter
+		r.clusters[cluster.Name] = cluster
+	}
+	return limiter
+}
+
+// forget forgets the failures of a sync of a resource to a cluster, after it succeeded or is no longer needed
+func (r *retrier) forget(item workItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if limiter, ok := r.limiters[item.cluster]; ok {
+		limiter.Forget(item)
+	}
+	delete(r.failing, item)
+	if _, ok := r.dead[item]; ok {
+		delete(r.dead, item)
+		deadLettersGauge.WithLabelValues(r.resource, item.cluster).Dec()
+	}
+}
+
+// forgetKey forgets the failures of syncs of the resource with the given key to every cluster
+func (r *retrier) forgetKey(key string) {
+	for _, item := range r.failingItems(key) {
+		r.forget(item)
+	}
+}
+
+// failingItems returns the syncs of the resource with the given key that are waiting for a retry or are dead letters
+func (r *retrier) failingItems(key string) []workItem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var items []workItem
+	for item := range r.failing {
+		if item.key == key {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// failingClusters returns the names of the clusters that syncs of the resource with the given key are failing on
+func (r *retrier) failingClusters(key string) map[string]bool {
+	clusters := make(map[string]bool)
+	for _, item := range r.failingItems(key) {
+		clusters[item.cluster] = true
+	}
+	return clusters
+}
+
+// deadLetters returns the dead letters ordered by key and cluster
+func (r *retrier) deadLetters() []DeadLetter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	letters := make([]DeadLetter, 0, len(r.dead))
+	for _, letter := range r.dead {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].Key != letters[j].Key {
+			return letters[i].Key < letters[j].Key
+		}
+		return letters[i].Cluster < letters[j].Cluster
+	})
+	return letters
+}
+
+// revive removes all dead letters and returns their work items so that they can be retried. The syncs are
+// still failing until they succeed, and become dead letters again if they run out of retries
+func (r *retrier) revive() []workItem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var items []workItem
+	for item := range r.dead {
+		items = append(items, item)
+		delete(r.dead, item)
+		deadLettersGauge.WithLabelValues(r.resource, item.cluster).Dec()
+	}
+	return items
+}
+
+// DeadLetterHandler serves the dead letters of controllers
+type DeadLetterHandler struct {
+	manager *Manager
+}
+
+// NewDeadLetterHandler creates a DeadLetterHandler that serves the dead letters of the controllers of manager
+func NewDeadLetterHandler(manager *Manager) *DeadLetterHandler {
+	return &DeadLetterHandler{
+		manager: manager,
+	}
+}
+
+// Register registers /deadletters on mux
+func (h *DeadLetterHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/deadletters", h.list)
+}
+
+// list responds with the dead letters of every controller
+func (h *DeadLetterHandler) list(w http.ResponseWriter, r *http.Request) {
+	letters := []DeadLetter{}
+	for _, c := range h.manager.Controllers() {
+		letters = append(letters, c.DeadLetters()...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(letters)
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestController_retrier(t *testing.T) {
+	r := newRetrier("configmaps")
+	cluster := Cluster{Name: "prod", MaxRetries: 2}
+	item := workItem{key: "default/cm", cluster: "prod"}
+	err := newTargetError("prod", fmt.Errorf("connection refused"))
+
+	_, ok := r.failed(item, cluster, err)
+	assert.True(t, ok, "Expected first failure to be retried")
+	_, ok = r.failed(item, cluster, err)
+	assert.True(t, ok, "Expected second failure to be retried")
+	_, ok = r.failed(item, cluster, err)
+	assert.False(t, ok, "Expected sync to become a dead letter")
+
+	letters := r.deadLetters()
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "prod", letters[0].Cluster)
+	assert.Equal(t, 2, letters[0].Retries)
+
+	// Revived dead letters are still failing until they succeed
+	assert.Equal(t, []workItem{item}, r.revive())
+	assert.Empty(t, r.deadLetters())
+	assert.Equal(t, map[string]bool{"prod": true}, r.failingClusters("default/cm"))
+	_, ok = r.failed(item, cluster, err)
+	assert.True(t, ok, "Expected revived dead letter to be retried")
+
+	r.forget(item)
+	assert.Empty(t, r.failingClusters("default/cm"))
+}
+
+func TestController_retrierPermanent(t *testing.T) {
+	r := newRetrier("configmaps")
+	item := workItem{key: "default/cm", cluster: "prod"}
+	err := newTargetError("prod", errors.NewForbidden(configMapGVR.GroupResource(), "cm", fmt.Errorf("denied")))
+
+	_, ok := r.failed(item, Cluster{Name: "prod"}, err)
+	assert.False(t, ok, "Expected permanent error not to be retried")
+	assert.Len(t, r.deadLetters(), 1)
+
+	r.forgetKey("default/cm")
+	assert.Empty(t, r.deadLetters())
+}
+
+func TestDeadLetterHandler(t *testing.T) {
+	m := NewManager(nil, record.NewFakeRecorder(10), nil, NewClusterRegistry(nil), NewSanitizerRegistry(nil), &Config{})
+	c := m.Add(*configMapGVR)
+	c.retrier.failed(workItem{key: "default/cm", cluster: "prod"}, Cluster{Name: "prod"}, &OwnershipError{Namespace: "default", Name: "cm", Cluster: "prod"})
+	h := NewDeadLetterHandler(m)
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/deadletters", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var letters []DeadLetter
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &letters))
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "configmaps", letters[0].Resource)
+	assert.Equal(t, "default/cm", letters[0].Key)
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+	"sync"
+	"sync/atomic"
+)
+
+// coreGroup is the name used for the core API group, whose actual name is empty, in include and exclude lists
+const coreGroup = "core"
+
+// CustomResourceDefinitionResource is the resource of CustomResourceDefinitions, which are watched to discover
+// resources installed at runtime
+var CustomResourceDefinitionResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// excludedResources are never discovered because they change constantly and are specific to the cluster they are in
+var excludedResources = map[schema.GroupResource]bool{
+	{Resource: "events"}:                                                   true,
+	{Group: "events.k8s.io", Resource: "events"}:                           true,
+	{Group: "coordination.k8s.io", Resource: "leases"}:                     true,
+	{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}: true,
+}
+
+// DiscoveryConfig holds the settings of discovering the resources to watch with the discovery API
+type DiscoveryConfig struct {
+	// Enabled watches every resource that can be listed and watched instead of the --informer flags
+	Enabled bool `yaml:"enabled,omitempty"`
+	// IncludeGroups limits the discovered resources to the given API groups. The core group is named core
+	IncludeGroups []string `yaml:"includeGroups,omitempty"`
+	// ExcludeGroups lists API groups whose resources are not discovered
+	ExcludeGroups []string `yaml:"excludeGroups,omitempty"`
+	// IncludeKinds limits the discovered resources to the given kinds
+	IncludeKinds []string `yaml:"includeKinds,omitempty"`
+	// ExcludeKinds lists kinds that are not discovered
+	ExcludeKinds []string `yaml:"excludeKinds,omitempty"`
+}
+
+// validate returns all problems with the discovery configuration
+func (d *DiscoveryConfig) validate() []error {
+	var errs []error
+	lists := []struct {
+		name  string
+		items []string
+	}{{"includeGroups", d.IncludeGroups}, {"excludeGroups", d.ExcludeGroups}, {"includeKinds", d.IncludeKinds}, {"excludeKinds", d.ExcludeKinds}}
+	for _, list := range lists {
+		for i, item := range list.items {
+			if item == "" {
+				errs = append(errs, fmt.Errorf("Empty entry at index %d of %s", i, list.name))
+			}
+		}
+	}
+	return errs
+}
+
+// matches returns true if resources of the given group and kind are discovered
+func (d *DiscoveryConfig) matches(group, kind string) bool {
+	if group == "" {
+		group = coreGroup
+	}
+	if contains(d.ExcludeGroups, group) || contains(d.ExcludeKinds, kind) {
+		return false
+	}
+	return (len(d.IncludeGroups) == 0 || contains(d.IncludeGroups, group)) && (len(d.IncludeKinds) == 0 || contains(d.IncludeKinds, kind))
+}
+
+// Discoverer finds the resources to watch with the discovery API, in the version preferred by the API server,
+// and adds them to a Manager. Resources that are installed or removed at runtime are picked up by watching
+// CustomResourceDefinitions.
+type Discoverer struct {
+	client  discovery.DiscoveryInterface
+	config  DiscoveryConfig
+	manager *Manager
+	crds    cache.SharedIndexInformer
+	trigger chan struct{}
+	mu      sync.Mutex
+	running map[schema.GroupResource]string
+	synced  int32
+}
+
+// NewDiscoverer creates a Discoverer that adds the discovered resources to manager, and removes them when they
+// are removed from the API server or their preferred version changes. CustomResourceDefinitions are watched
+// using dc unless it is nil
+func NewDiscoverer(client discovery.DiscoveryInterface, dc dynamic.Interface, config DiscoveryConfig, manager *Manager) *Discoverer {
+	d := &Discoverer{
+		client:  client,
+		config:  config,
+		manager: manager,
+		trigger: make(chan struct{}, 1),
+		running: make(map[schema.GroupResource]string),
+	}
+	if dc != nil {
+		d.crds = dynamicinformer.NewFilteredDynamicInformer(dc, CustomResourceDefinitionResource, v1.NamespaceAll, 0, cache.Indexers{}, nil).Informer()
+	}
+	return d
+}
+
+// Discover returns the resources that can be listed and watched and match the configuration, in the version
+// preferred by the API server. Resources of API groups that can't be discovered are left out and reported in the
+// returned error
+func (d *Discoverer) Discover() ([]schema.GroupVersionResource, error) {
+	lists, err := discovery.ServerPreferredResources(d.client)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	var gvrs []schema.GroupVersionResource
+	for _, list := range discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "watch"}}, lists) {
+		gv, parseErr := schema.ParseGroupVersion(list.GroupVersion)
+		if parseErr != nil {
+			klog.Errorf("Error parsing group version %s: %v", list.GroupVersion, parseErr)
+			continue
+		}
+		for _, r := range list.APIResources {
+			gvr := gv.WithResource(r.Name)
+			if excludedResources[gvr.GroupResource()] || !d.config.matches(gv.Group, r.Kind) {
+				continue
+			}
+			gvrs = append(gvrs, gvr)
+		}
+	}
+	return gvrs, err
+}
+
+// Run discovers the resources to watch and adds them to the manager, and discovers them again whenever a
+// CustomResourceDefinition changes. It blocks until stopCh is closed
+func (d *Discoverer) Run(stopCh <-chan struct{}) {
+	d.sync()
+	atomic.StoreInt32(&d.synced, 1)
+	if d.crds != nil {
+		d.crds.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				d.discoverAgain()
+			},
+			UpdateFunc: func(old, new interface{}) {
+				d.discoverAgain()
+			},
+			DeleteFunc: func(obj interface{}) {
+				d.discoverAgain()
+			},
+		})
+		go d.crds.Run(stopCh)
+	}
+
+	for {
+		select {
+		case <-d.trigger:
+			d.sync()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// HasSynced returns true once the resources have been discovered and added to the manager for the first time
+func (d *Discoverer) HasSynced() bool {
+	return atomic.LoadInt32(&d.synced) == 1
+}
+
+// discoverAgain schedules discovering the resources again. Requests made while one is pending are merged into it
+func (d *Discoverer) discoverAgain() {
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// sync adds resources that were discovered to the manager, and removes resources that were removed or whose
+// preferred version changed. Resources are only removed if every API group could be discovered
+func (d *Discoverer) sync() {
+	gvrs, err := d.Discover()
+	if err != nil {
+		klog.Errorf("Error discovering resources: %v", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	found := make(map[schema.GroupResource]bool)
+	for _, gvr := range gvrs {
+		gr := gvr.GroupResource()
+		found[gr] = true
+		if version, ok := d.running[gr]; ok {
+			if version == gvr.Version {
+				continue
+			}
+			klog.Infof("Preferred version of %s changed from %s to %s", gr.String(), version, gvr.Version)
+			d.manager.Remove(gr.WithVersion(version))
+		}
+		klog.Infof("Discovered %s", gvr.String())
+		d.running[gr] = gvr.Version
+		d.manager.Add(gvr)
+	}
+	if err != nil {
+		return
+	}
+	for gr, version := range d.running {
+		if !found[gr] {
+			klog.Infof("Resource %s was removed", gr.String())
+			d.manager.Remove(gr.WithVersion(version))
+			delete(d.running, gr)
+		}
+	}
+}
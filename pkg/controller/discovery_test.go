@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"testing"
+	"time"
+)
+
+var watchable = v1.Verbs{"get", "list", "watch"}
+
+func newFakeDiscovery() *fakediscovery.FakeDiscovery {
+	return &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*v1.APIResourceList{
+		{GroupVersion: "v1", APIResources: []v1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Verbs: watchable},
+			{Name: "secrets", Kind: "Secret", Verbs: watchable},
+			{Name: "events", Kind: "Event", Verbs: watchable},
+			{Name: "bindings", Kind: "Binding", Verbs: v1.Verbs{"create"}},
+			{Name: "pods/status", Kind: "Pod", Verbs: watchable},
+		}},
+		{GroupVersion: "apps/v1", APIResources: []v1.APIResource{
+			{Name: "deployments", Kind: "Deployment", Verbs: watchable},
+		}},
+		{GroupVersion: "example.com/v1", APIResources: []v1.APIResource{
+			{Name: "widgets", Kind: "Widget", Verbs: watchable},
+		}},
+		{GroupVersion: "example.com/v1beta1", APIResources: []v1.APIResource{
+			{Name: "widgets", Kind: "Widget", Verbs: watchable},
+		}},
+	}}}
+}
+
+func TestDiscoverer_Discover(t *testing.T) {
+	d := NewDiscoverer(newFakeDiscovery(), nil, DiscoveryConfig{Enabled: true}, nil)
+	gvrs, err := d.Discover()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []schema.GroupVersionResource{
+		{Version: "v1", Resource: "configmaps"},
+		{Version: "v1", Resource: "secrets"},
+		{Group: "apps", Version: "v1", Resource: "deployments"},
+		{Group: "example.com", Version: "v1", Resource: "widgets"},
+	}, gvrs, "Expected watchable resources in their preferred version")
+
+	d.config = DiscoveryConfig{IncludeGroups: []string{"core", "example.com"}, ExcludeKinds: []string{"Secret"}}
+	gvrs, err = d.Discover()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []schema.GroupVersionResource{
+		{Version: "v1", Resource: "configmaps"},
+		{Group: "example.com", Version: "v1", Resource: "widgets"},
+	}, gvrs, "Expected resources to be filtered by group and kind")
+}
+
+func TestDiscoverer_sync(t *testing.T) {
+	client := newFakeDiscovery()
+	m := NewManager(nil, record.NewFakeRecorder(10), nil, NewClusterRegistry(nil), NewSanitizerRegistry(nil), &Config{})
+	d := NewDiscoverer(client, nil, DiscoveryConfig{IncludeKinds: []string{"Widget"}}, m)
+	v1Widgets := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	v2Widgets := schema.GroupVersionResource{Group: "example.com", Version: "v2", Resource: "widgets"}
+	d.sync()
+	assert.Equal(t, []schema.GroupVersionResource{v1Widgets}, managedResources(m))
+	v1Controller := m.Controllers()[0]
+
+	// Controllers are replaced when the preferred version changes
+	client.Resources[2] = &v1.APIResourceList{GroupVersion: "example.com/v2", APIResources: []v1.APIResource{{Name: "widgets", Kind: "Widget", Verbs: watchable}}}
+	d.sync()
+	assert.Equal(t, []schema.GroupVersionResource{v2Widgets}, managedResources(m))
+	assert.True(t, v1Controller.stopped(), "Expected controller of the previous version to be stopped")
+
+	// Controllers are removed when the resource is removed
+	client.Resources = client.Resources[:2]
+	d.sync()
+	assert.Empty(t, managedResources(m))
+	assert.Empty(t, d.running)
+}
+
+func TestDiscoverer_Run(t *testing.T) {
+	m := NewManager(nil, record.NewFakeRecorder(10), nil, NewClusterRegistry(nil), NewSanitizerRegistry(nil), &Config{})
+	d := NewDiscoverer(newFakeDiscovery(), nil, DiscoveryConfig{IncludeKinds: []string{"Widget"}}, m)
+	assert.False(t, d.HasSynced())
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go d.Run(stopCh)
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return d.HasSynced(), nil
+	})
+	assert.NoError(t, err, "Expected first discovery to complete")
+	assert.Len(t, m.Controllers(), 1, "Expected discovered resources to be added before synced")
+}
+
+// managedResources returns the resources that m has controllers for
+func managedResources(m *Manager) []schema.GroupVersionResource {
+	var res []schema.GroupVersionResource
+	for _, c := range m.Controllers() {
+		res = append(res, *c.gvr)
+	}
+	return res
+}
+
+func TestConfig_ValidateDiscovery(t *testing.T) {
+	config := &Config{Discovery: DiscoveryConfig{Enabled: true, IncludeGroups: []string{"core", ""}, ExcludeKinds: []string{""}}}
+	assert.Error(t, config.Validate())
+}
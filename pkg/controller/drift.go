@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+	"reflect"
+	"sync"
+)
+
+// driftWatcher runs an informer in each cluster for resources of one kind that carry the ownership markers of
+// this synka instance. Changes to these resources are passed to handle.
+type driftWatcher struct {
+	mu       sync.Mutex
+	gvr      schema.GroupVersionResource
+	selector string
+	clusters *ClusterRegistry
+	handle   func(cluster string, u *unstructured.Unstructured)
+	stops    map[string]chan struct{}
+	stopped  bool
+}
+
+// newDriftWatcher creates a driftWatcher for resources of the given kind owned by the synka instance described by config
+func newDriftWatcher(gvr schema.GroupVersionResource, config *Config, clusters *ClusterRegistry, handle func(string, *unstructured.Unstructured)) *driftWatcher {
+	return &driftWatcher{
+		gvr: gvr,
+		selector: labels.SelectorFromSet(labels.Set{
+			managedByLabelKey: managedByLabelValue,
+			instanceLabelKey:  config.instanceName(),
+		}).String(),
+		clusters: clusters,
+		handle:   handle,
+		stops:    make(map[string]chan struct{}),
+	}
+}
+
+// Run starts an informer in every cluster and restarts them when clusters change. It blocks until stopCh is closed
+func (w *driftWatcher) Run(stopCh <-chan struct{}) {
+	unregister := w.clusters.OnChange(w.restart)
+	var names []string
+	for _, cluster := range w.clusters.List() {
+		names = append(names, cluster.Name)
+	}
+	w.restart(names)
+	<-stopCh
+	unregister()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	for name, stop := range w.stops {
+		close(stop)
+		delete(w.stops, name)
+	}
+}
+
+// restart stops the informers of the clusters with the given names and starts new ones with their current configuration.
+// Informers of clusters that no longer exist are stopped. Does nothing once the watcher is stopped
+func (w *driftWatcher) restart(names []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	for _, name := range names {
+		if stop, ok := w.stops[name]; ok {
+			close(stop)
+			delete(w.stops, name)
+		}
+	}
+	for name, stop := range w.stops {
+		if _, ok := w.clusters.Get(name); !ok {
+			close(stop)
+			delete(w.stops, name)
+		}
+	}
+
+	for _, name := range names {
+		cluster, ok := w.clusters.Get(name)
+		if !ok {
+			continue
+		}
+		client, err := w.clusters.Clients().Get(cluster)
+		if err != nil {
+			klog.Errorf("Error watching %s for drift on %s: %v", w.gvr.GroupResource().String(), name, err)
+			continue
+		}
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, v1.NamespaceAll, func(opts *v1.ListOptions) {
+			opts.LabelSelector = w.selector
+		})
+		informer := factory.ForResource(w.gvr).Informer()
+		informer.AddEventHandler(w.handlers(name))
+		stop := make(chan struct{})
+		w.stops[name] = stop
+		go informer.Run(stop)
+	}
+}
+
+// handlers returns event handlers that pass the resources in the named cluster to handle when they are listed, changed or
+// deleted. Deleted resources are passed with a deletion timestamp
+func (w *driftWatcher) handlers(cluster string) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				w.handle(cluster, u)
+			}
+		},
+		UpdateFunc: func(old, new interface{}) {
+			if u, ok := new.(*unstructured.Unstructured); ok {
+				w.handle(cluster, u)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				u = u.DeepCopy()
+				now := v1.Now()
+				u.SetDeletionTimestamp(&now)
+				w.handle(cluster, u)
+			}
+		},
+	}
+}
+
+// handleDrift checks if the resource live in the named cluster has drifted from the source resource, and reverts or
+// reports the drift according to the drift policy of the source resource
+func (c *Controller) handleDrift(cluster string, live *unstructured.Unstructured) {
+	key, err := cache.MetaNamespaceKeyFunc(live)
+	if err != nil {
+		return
+	}
+	obj, exists, err := c.indexer.GetByKey(key)
+	if err != nil || !exists {
+		return
+	}
+	u := obj.(*unstructured.Unstructured).DeepCopy()
+
+	// Only resources that are synced to the cluster are of interest
+	sc, _, err := c.syncConfigFor(u)
+	if err != nil || !sc.Sync {
+		return
+	}
+	policy := c.driftPolicyFor(sc)
+	if policy == DriftIgnore {
+		return
+	}
+	clusters, _, _ := selectClusters(sc, c.clusters.List())
+	var target *Cluster
+	for i := range clusters {
+		if clusters[i].Name == cluster {
+			target = &clusters[i]
+		}
+	}
+	if target == nil {
+		return
+	}
+
+	desired := c.transform(u, *target)
+	if !isOwned(live, desired, false) || !hasDrifted(desired, live) {
+		return
+	}
+
+	switch policy {
+	case DriftRevert:
+		klog.V(2).Infof("Reverting drift of %s/%s/%s on %s", u.GetAPIVersion(), u.GetKind(), u.GetName(), cluster)
+		c.queue.Add(c.newItem(key, cluster))
+	case DriftReport:
+		msg := fmt.Sprintf("Resource has drifted on %s", cluster)
+		if live.GetDeletionTimestamp() != nil {
+			msg = fmt.Sprintf("Resource was deleted on %s", cluster)
+		}
+		klog.Infof("%s/%s/%s: %s", u.GetAPIVersion(), u.GetKind(), u.GetName(), msg)
+		c.recorder.Event(u, corev1.EventTypeWarning, reasonDrift, msg)
+	}
+}
+
+// driftPolicyFor returns the drift policy of a resource with the sync config sc, which is the default drift
+// policy unless sc has one
+func (c *Controller) driftPolicyFor(sc SyncConfig) DriftPolicy {
+	if sc.DriftPolicy == "" {
+		return c.config.defaultDriftPolicy()
+	}
+	return sc.DriftPolicy
+}
+
+// hasDrifted returns true if live is deleted or doesn't contain every field of desired with the same value.
+// Fields that only exist in live, such as defaults set by the API server, are not considered drift
+func hasDrifted(desired, live *unstructured.Unstructured) bool {
+	if live.GetDeletionTimestamp() != nil {
+		return true
+	}
+	return !isSubset(desired.Object, live.Object)
+}
+
+// isSubset returns true if every field of a exists in b with the same value. Lists must have the same length.
+// Maps and lists in a that only hold empty values are treated as missing, since the API server may drop them
+func isSubset(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b == nil {
+			b = map[string]interface{}{}
+		}
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range a {
+			if !isSubset(v, b[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		if b == nil {
+			b = []interface{}{}
+		}
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !isSubset(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"testing"
+	"time"
+)
+
+func TestHasDrifted(t *testing.T) {
+	desired := newConfigMap("cm", map[string]string{"app": "test"})
+	desired.Object["data"] = map[string]interface{}{"key": "value"}
+	desired.Object["spec"] = map[string]interface{}{"ports": []interface{}{}, "template": map[string]interface{}{}}
+
+	live := desired.DeepCopy()
+	delete(live.Object, "spec")
+	live.SetResourceVersion("2")
+	live.Object["data"].(map[string]interface{})["extra"] = "value"
+	assert.False(t, hasDrifted(desired, live), "Expected extra fields and dropped empty fields not to be drift")
+
+	live.Object["data"].(map[string]interface{})["key"] = "changed"
+	assert.True(t, hasDrifted(desired, live), "Expected changed field to be drift")
+
+	live = desired.DeepCopy()
+	live.SetLabels(nil)
+	assert.True(t, hasDrifted(desired, live), "Expected removed label to be drift")
+
+	live = desired.DeepCopy()
+	now := v1.Now()
+	live.SetDeletionTimestamp(&now)
+	assert.True(t, hasDrifted(desired, live), "Expected deleted resource to be drift")
+}
+
+func TestHasDrifted_controllerAnnotations(t *testing.T) {
+	r := NewSanitizerRegistry(nil)
+	for kind, key := range map[string]string{
+		"Deployment": "deployment.kubernetes.io/revision",
+		"DaemonSet":  "deprecated.daemonset.template.generation",
+	} {
+		desired := newConfigMap("app", nil)
+		desired.SetAPIVersion("apps/v1")
+		desired.SetKind(kind)
+		desired.SetAnnotations(map[string]string{key: "5"})
+		r.Sanitize(desired)
+		assert.NotContains(t, desired.GetAnnotations(), key, "Expected %s to be sanitized from %s", key, kind)
+
+		// The controller in the target cluster sets its own value
+		live := desired.DeepCopy()
+		live.SetAnnotations(map[string]string{key: "1"})
+		assert.False(t, hasDrifted(desired, live), "Expected %s rewritten by the controller not to be drift", key)
+	}
+}
+
+func TestController_handleDrift(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	c := NewManager(nil, recorder, nil, NewClusterRegistry([]Cluster{defaultCluster}), NewSanitizerRegistry(nil), &Config{Name: "source"}).Add(*configMapGVR)
+	c.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+	u := newConfigMap("cm", nil)
+	u.SetUID("1234")
+	u.Object["data"] = map[string]interface{}{"key": "value"}
+	assert.NoError(t, c.indexer.Add(u))
+	live := c.transform(u, defaultCluster)
+	live.Object["data"] = map[string]interface{}{"key": "changed"}
+
+	setPolicy := func(policy DriftPolicy) {
+		u.SetAnnotations(map[string]string{syncAnnotationKey: "true", driftPolicyAnnotationKey: string(policy)})
+		assert.NoError(t, c.indexer.Update(u))
+		live.SetAnnotations(c.transform(u, defaultCluster).GetAnnotations())
+	}
+
+	setPolicy(DriftIgnore)
+	c.handleDrift(defaultCluster.Name, live)
+	assert.Equal(t, 0, c.queue.Len(), "Expected ignored drift not to be reverted")
+	assert.Empty(t, recorder.Events, "Expected ignored drift not to be reported")
+
+	setPolicy(DriftReport)
+	c.handleDrift(defaultCluster.Name, live)
+	assert.Equal(t, 0, c.queue.Len(), "Expected reported drift not to be reverted")
+	assert.Equal(t, "Warning Drift Resource has drifted on "+defaultCluster.Name, <-recorder.Events)
+
+	setPolicy(DriftRevert)
+	c.handleDrift("unknown", live)
+	assert.Equal(t, 0, c.queue.Len(), "Expected drift on unselected cluster to be ignored")
+	c.handleDrift(defaultCluster.Name, live)
+	assert.Equal(t, 1, c.queue.Len(), "Expected drift to be reverted")
+
+	foreign := live.DeepCopy()
+	foreign.SetLabels(nil)
+	c.queue.Get()
+	c.handleDrift(defaultCluster.Name, foreign)
+	assert.Equal(t, 0, c.queue.Len(), "Expected resources not owned by synka to be ignored")
+}
+
+func TestController_watchDrift(t *testing.T) {
+	registry := NewClusterRegistry([]Cluster{defaultCluster})
+	setClient(registry.Clients(), defaultCluster, fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	c := NewManager(nil, record.NewFakeRecorder(10), nil, registry, NewSanitizerRegistry(nil), &Config{Name: "source"}).Add(*configMapGVR)
+	defer c.stop()
+	c.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	c.run()
+	listeners := func() int {
+		registry.mu.RLock()
+		defer registry.mu.RUnlock()
+		return len(registry.listeners)
+	}
+	assert.Equal(t, 1, listeners(), "Expected clusters not to be watched for drift by default")
+
+	u := newConfigMap("cm", nil)
+	u.SetAnnotations(map[string]string{syncAnnotationKey: "true"})
+	assert.NoError(t, c.indexer.Add(u))
+	assert.NoError(t, c.syncToStdout(c.newItem("default/cm", "")))
+	assert.Equal(t, 1, listeners(), "Expected clusters not to be watched for resources that ignore drift")
+
+	u = u.DeepCopy()
+	u.SetAnnotations(map[string]string{syncAnnotationKey: "true", driftPolicyAnnotationKey: string(DriftRevert)})
+	assert.NoError(t, c.indexer.Update(u))
+	assert.NoError(t, c.syncToStdout(c.newItem("default/cm", "")))
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return listeners() == 2, nil
+	})
+	assert.NoError(t, err, "Expected clusters to be watched once a resource reverts drift")
+}
+
+func TestDriftWatcher_Run(t *testing.T) {
+	registry := NewClusterRegistry([]Cluster{defaultCluster})
+	setClient(registry.Clients(), defaultCluster, fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	w := newDriftWatcher(*configMapGVR, &Config{}, registry, func(string, *unstructured.Unstructured) {})
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		w.Run(stopCh)
+		close(done)
+	}()
+
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.stops) == 1, nil
+	})
+	assert.NoError(t, err, "Expected informer to be started for the cluster")
+
+	close(stopCh)
+	<-done
+	w.restart([]string{defaultCluster.Name})
+	assert.Empty(t, w.stops, "Expected no informers to be started once stopped")
+	assert.Empty(t, registry.listeners, "Expected listener to be unregistered")
+}
+
+func TestIsSubset(t *testing.T) {
+	assert.True(t, isSubset(map[string]interface{}{"a": int64(1)}, map[string]interface{}{"a": int64(1), "b": "c"}))
+	assert.False(t, isSubset(map[string]interface{}{"a": int64(1)}, map[string]interface{}{"a": int64(2)}))
+	assert.False(t, isSubset([]interface{}{"a"}, []interface{}{"a", "b"}))
+	assert.True(t, isSubset([]interface{}{map[string]interface{}{"a": "b"}}, []interface{}{map[string]interface{}{"a": "b", "c": "d"}}))
+	assert.True(t, isSubset(map[string]interface{}{}, nil))
+	assert.False(t, isSubset(map[string]interface{}{}, "a"))
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"net"
+)
+
+// ErrorClass groups the errors returned when writing to a cluster by how synka handles them
+type ErrorClass string
+
+const (
+	// ErrorNotFound means that the resource, or the namespace it belongs in, doesn't exist in the cluster
+	ErrorNotFound ErrorClass = "NotFound"
+	// ErrorConflict means that the resource was modified or created concurrently by someone else
+	ErrorConflict ErrorClass = "Conflict"
+	// ErrorForbidden means that synka isn't allowed to write the resource. Retrying won't help
+	ErrorForbidden ErrorClass = "Forbidden"
+	// ErrorUnauthorized means that the cluster didn't accept the credentials of synka, which may be expired
+	// credentials that are refreshed later
+	ErrorUnauthorized ErrorClass = "Unauthorized"
+	// ErrorInvalid means that the cluster rejected the resource. Retrying won't help
+	ErrorInvalid ErrorClass = "Invalid"
+	// ErrorThrottled means that the API server of the cluster asked synka to slow down
+	ErrorThrottled ErrorClass = "Throttled"
+	// ErrorUnreachable means that the API server of the cluster couldn't be reached in time
+	ErrorUnreachable ErrorClass = "Unreachable"
+	// ErrorUnknown is any other error
+	ErrorUnknown ErrorClass = "Unknown"
+)
+
+// TargetError is returned when writing a resource to a cluster fails
+type TargetError struct {
+	Cluster string
+	Class   ErrorClass
+	Err     error
+}
+
+func (e *TargetError) Error() string {
+	return fmt.Sprintf("%s error from %s: %v", e.Class, e.Cluster, e.Err)
+}
+
+// Unwrap returns the error returned by the API server
+func (e *TargetError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent returns true if retrying the write won't succeed until the resource or the permissions of synka change
+func (e *TargetError) Permanent() bool {
+	return e.Class == ErrorForbidden || e.Class == ErrorInvalid
+}
+
+// newTargetError classifies err returned when writing to the named cluster. Ownership errors and nil are returned as is
+func newTargetError(cluster string, err error) error {
+	switch err.(type) {
+	case nil, *OwnershipError, *TargetError:
+		return err
+	}
+	return &TargetError{Cluster: cluster, Class: classifyError(err), Err: err}
+}
+
+// classifyError returns the class of an error returned by the API server of a cluster or by the client connecting to it
+func classifyError(err error) ErrorClass {
+	var netErr net.Error
+	switch {
+	case apierrors.IsNotFound(err), apierrors.IsGone(err):
+		return ErrorNotFound
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		return ErrorConflict
+	case apierrors.IsForbidden(err):
+		return ErrorForbidden
+	case apierrors.IsUnauthorized(err):
+		return ErrorUnauthorized
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err), apierrors.IsMethodNotSupported(err),
+		apierrors.IsNotAcceptable(err), apierrors.IsUnsupportedMediaType(err), apierrors.IsRequestEntityTooLargeError(err):
+		return ErrorInvalid
+	case apierrors.IsTooManyRequests(err), apierrors.IsServerTimeout(err), apierrors.IsServiceUnavailable(err):
+		return ErrorThrottled
+	case apierrors.IsTimeout(err), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return ErrorUnreachable
+	}
+	return ErrorUnknown
+}
+
+// isPermanent returns true if err, or every error that it aggregates, won't go away by retrying
+func isPermanent(err error) bool {
+	switch err := err.(type) {
+	case *OwnershipError:
+		return true
+	case *TargetError:
+		return err.Permanent()
+	case utilerrors.Aggregate:
+		for _, err := range err.Errors() {
+			if !isPermanent(err) {
+				return false
+			}
+		}
+		return len(err.Errors()) > 0
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestController_classifyError(t *testing.T) {
+	gr := configMapGVR.GroupResource()
+	tests := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{errors.NewNotFound(gr, "cm"), ErrorNotFound},
+		{errors.NewConflict(gr, "cm", fmt.Errorf("modified")), ErrorConflict},
+		{errors.NewAlreadyExists(gr, "cm"), ErrorConflict},
+		{errors.NewForbidden(gr, "cm", fmt.Errorf("denied")), ErrorForbidden},
+		{errors.NewUnauthorized("expired"), ErrorUnauthorized},
+		{errors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "cm", nil), ErrorInvalid},
+		{errors.NewBadRequest("bad"), ErrorInvalid},
+		{errors.NewTooManyRequests("slow down", 1), ErrorThrottled},
+		{errors.NewServiceUnavailable("unavailable"), ErrorThrottled},
+		{errors.NewTimeoutError("timeout", 1), ErrorUnreachable},
+		{context.DeadlineExceeded, ErrorUnreachable},
+		{&url.Error{Op: "Get", URL: "https://prod:6443", Err: &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}}, ErrorUnreachable},
+		{errors.NewInternalError(fmt.Errorf("boom")), ErrorUnknown},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.class, classifyError(test.err), "Unexpected class of %v", test.err)
+	}
+}
+
+func TestController_isPermanent(t *testing.T) {
+	gr := configMapGVR.GroupResource()
+	forbidden := newTargetError("prod", errors.NewForbidden(gr, "cm", fmt.Errorf("denied")))
+	throttled := newTargetError("dev", errors.NewTooManyRequests("slow down", 1))
+
+	assert.True(t, isPermanent(forbidden))
+	assert.True(t, isPermanent(&OwnershipError{}))
+	assert.False(t, isPermanent(throttled))
+	assert.False(t, isPermanent(newTargetError("prod", errors.NewUnauthorized("expired"))), "Expected expired credentials to be retried")
+	assert.True(t, isPermanent(utilerrors.NewAggregate([]error{forbidden, &OwnershipError{}})))
+	assert.False(t, isPermanent(utilerrors.NewAggregate([]error{forbidden, throttled})), "Expected transient errors to be retried")
+	assert.False(t, isPermanent(fmt.Errorf("unknown")))
+	assert.Equal(t, "Forbidden error from prod: configmaps \"cm\" is forbidden: denied", forbidden.Error())
+}
+
+func TestController_updateOrCreateGetError(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	client.PrependReactor("get", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(configMapGVR.GroupResource(), "cm", fmt.Errorf("denied"))
+	})
+
+	_, _, err := updateOrCreate(context.Background(), client, configMapGVR, newConfigMap("cm", nil), true, false)
+	assert.True(t, errors.IsForbidden(err), "Expected error from get to be returned")
+	for _, action := range client.Actions() {
+		assert.NotEqual(t, "create", action.GetVerb(), "Expected no create after failed get")
+	}
+}
+
+func TestController_updateOrCreateRetriesConflict(t *testing.T) {
+	existing := newConfigMap("cm", nil)
+	existing.SetResourceVersion("1")
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), existing)
+	conflicts := 1
+	client.PrependReactor("update", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, errors.NewConflict(configMapGVR.GroupResource(), "cm", fmt.Errorf("modified"))
+		}
+		return false, nil, nil
+	})
+
+	_, _, err := updateOrCreate(context.Background(), client, configMapGVR, newConfigMap("cm", nil), true, true)
+	assert.NoError(t, err)
+	var gets int
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "get" {
+			gets++
+		}
+	}
+	assert.Equal(t, 2, gets, "Expected the resource to be fetched again after a conflict")
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+const (
+	reasonConflict        = "Conflict"
+	reasonUnknownCluster  = "UnknownCluster"
+	reasonInvalidSelector = "InvalidSelector"
+	reasonInvalidConfig   = "InvalidConfig"
+	reasonDrift           = "Drift"
+	reasonSyncSucceeded   = "SyncSucceeded"
+	reasonSyncFailed      = "SyncFailed"
+	reasonSkippedExisting = "SkippedExisting"
+)
+
+// NewEventRecorder creates an EventRecorder that records events on resources in the cluster that synka runs in
+func NewEventRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(klog.Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "synka"})
+}
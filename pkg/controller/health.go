@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/client-go/tools/cache"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HealthHandler serves the liveness and readiness endpoints of synka, and an endpoint that checks which
+// clusters can be reached
+type HealthHandler struct {
+	manager  *Manager
+	clusters *ClusterRegistry
+	synced   []cache.InformerSynced
+}
+
+// ClusterCheck is the result of checking that a cluster can be reached
+type ClusterCheck struct {
+	Reachable     bool   `json:"reachable"`
+	ServerVersion string `json:"serverVersion,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// NewHealthHandler creates a HealthHandler that checks the clusters in the given registry. Synka is ready once
+// manager has synced its caches and every function in synced returns true. Caches of the controllers aren't
+// waited for, since a single resource that can't be listed would keep synka from ever becoming ready
+func NewHealthHandler(clusters *ClusterRegistry, manager *Manager, synced ...cache.InformerSynced) *HealthHandler {
+	return &HealthHandler{
+		manager:  manager,
+		clusters: clusters,
+		synced:   synced,
+	}
+}
+
+// Register registers /healthz, /readyz and /healthz/clusters/ on mux
+func (h *HealthHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/readyz", h.readyz)
+	mux.HandleFunc("/healthz/clusters/", h.clusterz)
+}
+
+// healthz reports that synka is alive
+func (h *HealthHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+// readyz reports that synka is ready once the manager has synced its caches
+func (h *HealthHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	for _, synced := range append([]cache.InformerSynced{h.manager.HasSynced}, h.synced...) {
+		if !synced() {
+			http.Error(w, "waiting for caches to sync", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprint(w, "ok")
+}
+
+// clusterz checks that clusters can be reached. /healthz/clusters/ checks all clusters and /healthz/clusters/<name>
+// checks a single cluster. Responds with 503 if any of the checked clusters can't be reached
+func (h *HealthHandler) clusterz(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/healthz/clusters/")
+	clusters := h.clusters.List()
+	if name != "" {
+		cluster, ok := h.clusters.Get(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("cluster %s not found", name), http.StatusNotFound)
+			return
+		}
+		clusters = []Cluster{cluster}
+	}
+
+	checks := h.check(clusters)
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.Reachable {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(checks)
+}
+
+// check connects to each of the clusters concurrently and records the results in the client pool
+func (h *HealthHandler) check(clusters []Cluster) map[string]ClusterCheck {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	checks := make(map[string]ClusterCheck)
+	for _, cluster := range clusters {
+		wg.Add(1)
+		go func(cluster Cluster) {
+			defer wg.Done()
+			version, err := probe(cluster)
+			h.clusters.Clients().Observe(cluster.Name, err)
+			check := ClusterCheck{Reachable: err == nil, ServerVersion: version}
+			if err != nil {
+				check.Error = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			checks[cluster.Name] = check
+		}(cluster)
+	}
+	wg.Wait()
+	return checks
+}
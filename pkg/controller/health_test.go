@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHealthHandler_readyz(t *testing.T) {
+	m := NewManager(nil, record.NewFakeRecorder(10), nil, NewClusterRegistry(nil), NewSanitizerRegistry(nil), &Config{})
+	c := m.Add(*configMapGVR)
+	discovered := false
+	h := NewHealthHandler(NewClusterRegistry(nil), m, func() bool { return discovered })
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "Expected not to be ready before caches have synced")
+
+	atomic.StoreInt32(&m.synced, 1)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "Expected not to be ready before resources are discovered")
+
+	discovered = true
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "Expected to be ready after caches have synced")
+	assert.False(t, c.HasSynced(), "Expected readiness not to wait for controllers")
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "Expected to be alive")
+}
+
+func TestHealthHandler_clusterz(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"gitVersion":"v1.18.2"}`)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	h := NewHealthHandler(NewClusterRegistry([]Cluster{
+		{Name: "up", Server: up.URL},
+		{Name: "down", Server: down.URL},
+	}), nil)
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz/clusters/up", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "Expected reachable cluster to be healthy")
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz/clusters/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "Expected unreachable cluster to be reported")
+	checks := make(map[string]ClusterCheck)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&checks))
+	assert.True(t, checks["up"].Reachable, "Expected cluster to be reachable")
+	assert.Equal(t, "v1.18.2", checks["up"].ServerVersion, "Unexpected server version")
+	assert.False(t, checks["down"].Reachable, "Expected cluster to be unreachable")
+	assert.NotEmpty(t, checks["down"].Error, "Expected error to be reported")
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz/clusters/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "Expected unknown cluster not to be found")
+}
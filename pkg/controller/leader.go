@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+	"time"
+)
+
+var (
+	isLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader",
+		Help:      "1 if this instance of synka is the leader and syncs resources, 0 if it is a standby.",
+	})
+
+	leaderTransitions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader_transitions_total",
+		Help:      "Number of times this instance of synka has started or stopped leading.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(isLeader, leaderTransitions)
+}
+
+// AlwaysLead returns a closed channel, for running a single instance of synka without leader election
+func AlwaysLead() <-chan struct{} {
+	isLeader.Set(1)
+	leading := make(chan struct{})
+	close(leading)
+	return leading
+}
+
+// RunLeaderElection takes part in leader election using the Lease with the given name and namespace. The returned channel
+// is closed when this instance, identified by identity, becomes the leader. Until then the instance is a standby that keeps
+// its caches warm. The process exits if leadership is lost, since the controllers can't be stopped safely while they
+// are writing to clusters. Leadership is released when stopCh is closed.
+func RunLeaderElection(client kubernetes.Interface, namespace, name, identity string, stopCh <-chan struct{}) <-chan struct{} {
+	leading := make(chan struct{})
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: v1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Client: client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	go leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   time.Second * 15,
+		RenewDeadline:   time.Second * 10,
+		RetryPeriod:     time.Second * 2,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("Started leading as %s", identity)
+				isLeader.Set(1)
+				leaderTransitions.Inc()
+				close(leading)
+			},
+			OnStoppedLeading: func() {
+				select {
+				case <-leading:
+				default:
+					// Never started leading
+					return
+				}
+				isLeader.Set(0)
+				leaderTransitions.Inc()
+				if ctx.Err() != nil {
+					klog.Infof("Released leadership as %s", identity)
+					return
+				}
+				klog.Fatalf("Lost leadership as %s, exiting", identity)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					klog.Infof("Leader is %s, waiting as a standby", leader)
+				}
+			},
+		},
+	})
+
+	return leading
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func TestRunLeaderElection(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	stopCh := make(chan struct{})
+	leading := RunLeaderElection(client, "default", "synka", "a", stopCh)
+
+	select {
+	case <-leading:
+	case <-time.After(time.Second * 10):
+		t.Fatal("Timed out waiting for leadership")
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(isLeader), "Expected to be leader")
+
+	lease, err := client.CoordinationV1().Leases("default").Get(context.Background(), "synka", v1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", *lease.Spec.HolderIdentity, "Unexpected holder of the lease")
+
+	standby := RunLeaderElection(client, "default", "synka", "b", stopCh)
+	select {
+	case <-standby:
+		t.Fatal("Expected second instance to be a standby")
+	case <-time.After(time.Second):
+	}
+	close(stopCh)
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// queueName is the name of the workqueue shared by all controllers, used as the name label of its metrics
+const queueName = "synka"
+
+// requeueDelay is the time after which an item of a resource that can't be synced yet is processed again
+const requeueDelay = 100 * time.Millisecond
+
+// Manager runs the controllers of every watched resource. The controllers share a single workqueue whose items are
+// keyed by GroupVersionResource and namespace/name, and a single pool of workers, so that watching another resource
+// only adds an informer. Every resource has an informer of its own that is stopped when the resource is removed.
+// A Manager is safe for concurrent use.
+type Manager struct {
+	client      dynamic.Interface
+	queue       workqueue.RateLimitingInterface
+	recorder    record.EventRecorder
+	policies    *PolicyStore
+	clusters    *ClusterRegistry
+	sanitizers  *SanitizerRegistry
+	config      *Config
+	mu          sync.RWMutex
+	controllers map[schema.GroupVersionResource]*Controller
+	stopCh      <-chan struct{}
+	leading     <-chan struct{}
+	synced      int32
+}
+
+// NewManager creates a Manager without any resources. policies may be nil in which case only annotations are used to
+// decide which resources to sync
+func NewManager(client dynamic.Interface, recorder record.EventRecorder, policies *PolicyStore, clusters *ClusterRegistry, sanitizers *SanitizerRegistry, config *Config) *Manager {
+	m := &Manager{
+		client:      client,
+		queue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), queueName),
+		recorder:    recorder,
+		policies:    policies,
+		clusters:    clusters,
+		sanitizers:  sanitizers,
+		config:      config,
+		controllers: make(map[schema.GroupVersionResource]*Controller),
+	}
+	// Resources that already exist are synced again when the policies that apply to them change
+	if policies != nil {
+		policies.OnChange(m.enqueue)
+	}
+	return m
+}
+
+// Add creates the controller of the given resource and returns it, or returns the existing controller if the
+// resource was already added. Resources added while the manager is running are synced once their informer
+// cache has synced.
+// See https://godoc.org/k8s.io/apimachinery/pkg/runtime/schema#GroupVersionResource for more information
+func (m *Manager) Add(gvr schema.GroupVersionResource) *Controller {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.controllers[gvr]; ok {
+		return c
+	}
+	c := newController(m, gvr)
+	m.controllers[gvr] = c
+	if m.stopCh != nil {
+		go c.informer.Run(c.stopCh)
+		go m.start(c)
+	}
+	return c
+}
+
+// Remove stops the controller of the given resource along with its informer, which drops the informer cache
+func (m *Manager) Remove(gvr schema.GroupVersionResource) {
+	m.mu.Lock()
+	c, ok := m.controllers[gvr]
+	delete(m.controllers, gvr)
+	m.mu.Unlock()
+	if ok {
+		c.stop()
+	}
+}
+
+// Controllers returns the controllers of every resource ordered by resource
+func (m *Manager) Controllers() []*Controller {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]*Controller, 0, len(m.controllers))
+	for _, c := range m.controllers {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].gvr.String() < res[j].gvr.String()
+	})
+	return res
+}
+
+// enqueue queues the resources of the given GroupVersionResources, in namespace only unless it is empty
+func (m *Manager) enqueue(gvrs []schema.GroupVersionResource, namespace string) {
+	for _, gvr := range gvrs {
+		c, ok := m.controller(gvr)
+		if !ok {
+			continue
+		}
+		if namespace == "" {
+			c.enqueueAll()
+		} else {
+			c.enqueueNamespace(namespace)
+		}
+	}
+}
+
+// controller returns the controller of the given resource
+func (m *Manager) controller(gvr schema.GroupVersionResource) (*Controller, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.controllers[gvr]
+	return c, ok
+}
+
+// Run starts the informers of every resource. Every controller is started on its own once its informer cache has
+// synced and leading is closed, so that a resource that can't be listed doesn't hold up the others, and standby
+// instances keep their caches warm. Once the sync policies have synced and leading is closed it starts the given
+// number of workers. It blocks until stopCh is closed, at which point it stops the controllers, shuts down the
+// workqueue and waits for the workers to finish the items they are working on.
+func (m *Manager) Run(workers int, stopCh <-chan struct{}, leading <-chan struct{}) {
+	defer runtime.HandleCrash()
+	m.mu.Lock()
+	m.stopCh = stopCh
+	m.leading = leading
+	for _, c := range m.controllers {
+		go c.informer.Run(c.stopCh)
+		go m.start(c)
+	}
+	count := len(m.controllers)
+	m.mu.Unlock()
+	defer m.stopAll()
+
+	if m.policies != nil && !cache.WaitForCacheSync(stopCh, m.policies.HasSynced) {
+		runtime.HandleError(fmt.Errorf("Timed out waiting for policy caches to sync"))
+		return
+	}
+	atomic.StoreInt32(&m.synced, 1)
+
+	// Wait until this instance is allowed to write to the clusters
+	select {
+	case <-leading:
+	case <-stopCh:
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(m.runWorker, time.Second, stopCh)
+		}()
+	}
+
+	klog.Infof("Started %d workers for %d resources", workers, count)
+	<-stopCh
+	klog.Infof("Shutting down workers")
+	m.queue.ShutDown()
+	wg.Wait()
+}
+
+// start starts a controller once its informer cache and the sync policies have synced and this instance is leading
+func (m *Manager) start(c *Controller) {
+	synced := []cache.InformerSynced{c.informer.HasSynced}
+	if m.policies != nil {
+		synced = append(synced, m.policies.HasSynced)
+	}
+	if !cache.WaitForCacheSync(c.stopCh, synced...) {
+		return
+	}
+	atomic.StoreInt32(&c.synced, 1)
+
+	select {
+	case <-m.leading:
+	case <-c.stopCh:
+		return
+	}
+	c.run()
+}
+
+// HasSynced returns true once the manager is running and the caches of the sync policies have synced
+func (m *Manager) HasSynced() bool {
+	return atomic.LoadInt32(&m.synced) == 1
+}
+
+// stopAll stops the controllers of every resource
+func (m *Manager) stopAll() {
+	for _, c := range m.Controllers() {
+		c.stop()
+	}
+}
+
+func (m *Manager) runWorker() {
+	for m.processNextItem() {
+	}
+}
+
+// processNextItem passes the next item of the queue to the controller of its resource. Items of resources that
+// were removed are dropped, and items of resources whose controller hasn't started yet, or that are synced by as
+// many workers as they are limited to, are queued again after a short delay. Returns false once the queue is shut down
+func (m *Manager) processNextItem() bool {
+	obj, quit := m.queue.Get()
+	if quit {
+		return false
+	}
+	defer m.queue.Done(obj)
+
+	// Leave the items that are still queued when shutting down
+	select {
+	case <-m.stopCh:
+		return false
+	default:
+	}
+
+	item := obj.(workItem)
+	c, ok := m.controller(item.gvr)
+	if !ok {
+		m.queue.Forget(item)
+		return true
+	}
+	if !c.isRunning() || !c.acquire() {
+		m.queue.AddAfter(item, requeueDelay)
+		return true
+	}
+	defer c.release()
+	c.process(item)
+	return true
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManager_Run(t *testing.T) {
+	u := newConfigMap("cm", nil)
+	u.SetAnnotations(map[string]string{syncAnnotationKey: "true"})
+	source := fake.NewSimpleDynamicClient(runtime.NewScheme(), u)
+	target := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	registry := NewClusterRegistry([]Cluster{defaultCluster})
+	setClient(registry.Clients(), defaultCluster, target)
+	m := NewManager(source, record.NewFakeRecorder(100), nil, registry, NewSanitizerRegistry(nil), &Config{})
+	c := m.Add(*configMapGVR)
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		m.Run(2, stopCh, AlwaysLead())
+		close(done)
+	}()
+
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, err := target.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "cm", v1.GetOptions{})
+		return err == nil, nil
+	})
+	assert.NoError(t, err, "Expected resource to be synced by the shared workers")
+	assert.True(t, c.HasSynced())
+	assert.True(t, m.HasSynced())
+
+	close(stopCh)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected manager to stop")
+	}
+	assert.True(t, c.stopped(), "Expected controllers to be stopped with the manager")
+}
+
+func TestManager_Remove(t *testing.T) {
+	m := NewManager(nil, record.NewFakeRecorder(10), nil, NewClusterRegistry(nil), NewSanitizerRegistry(nil), &Config{})
+	c := m.Add(*configMapGVR)
+	assert.Equal(t, c, m.Add(*configMapGVR), "Expected existing controller to be returned")
+
+	m.Remove(*configMapGVR)
+	assert.True(t, c.stopped())
+	assert.Empty(t, m.Controllers())
+
+	// Items of removed resources are dropped
+	m.queue.Add(c.newItem("default/cm", ""))
+	assert.True(t, m.processNextItem())
+	assert.Equal(t, 0, m.queue.Len())
+
+	// Resources that are added again get a new controller
+	assert.NotEqual(t, c, m.Add(*configMapGVR))
+}
+
+func TestManager_RemoveStopsInformer(t *testing.T) {
+	source := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	m := NewManager(source, record.NewFakeRecorder(100), nil, NewClusterRegistry(nil), NewSanitizerRegistry(nil), &Config{})
+	c := m.Add(*configMapGVR)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go m.Run(1, stopCh, AlwaysLead())
+
+	cached := func(name string) wait.ConditionFunc {
+		return func() (bool, error) {
+			_, ok, err := c.indexer.GetByKey("default/" + name)
+			return ok, err
+		}
+	}
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return c.HasSynced(), nil
+	}))
+	_, err := source.Resource(*configMapGVR).Namespace("default").Create(context.Background(), newConfigMap("a", nil), v1.CreateOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, wait.PollImmediate(10*time.Millisecond, 5*time.Second, cached("a")), "Expected informer to watch the resource")
+
+	m.Remove(*configMapGVR)
+	_, err = source.Resource(*configMapGVR).Namespace("default").Create(context.Background(), newConfigMap("b", nil), v1.CreateOptions{})
+	assert.NoError(t, err)
+	assert.Error(t, wait.PollImmediate(10*time.Millisecond, 200*time.Millisecond, cached("b")), "Expected informer to be stopped with the controller")
+}
+
+func TestManager_enqueue(t *testing.T) {
+	m := NewManager(nil, record.NewFakeRecorder(10), nil, NewClusterRegistry(nil), NewSanitizerRegistry(nil), &Config{})
+	c := m.Add(*configMapGVR)
+	other := newConfigMap("b", nil)
+	other.SetNamespace("other")
+	assert.NoError(t, c.indexer.Add(newConfigMap("a", nil)))
+	assert.NoError(t, c.indexer.Add(other))
+
+	m.enqueue([]schema.GroupVersionResource{*configMapGVR, {Version: "v1", Resource: "secrets"}}, "other")
+	assert.Equal(t, 1, m.queue.Len(), "Expected resources in the namespace only to be queued")
+	item, _ := m.queue.Get()
+	assert.Equal(t, "other/b", item.(workItem).key)
+	m.queue.Done(item)
+
+	m.enqueue([]schema.GroupVersionResource{*configMapGVR}, "")
+	assert.Equal(t, 2, m.queue.Len(), "Expected resources in every namespace to be queued")
+}
+
+func TestManager_processNextItemLimited(t *testing.T) {
+	config := &Config{Resources: []ResourceConfig{{Resource: "configmaps.v1.", Workers: 1}}}
+	m := NewManager(nil, record.NewFakeRecorder(10), nil, NewClusterRegistry(nil), NewSanitizerRegistry(nil), config)
+	c := m.Add(*configMapGVR)
+	atomic.StoreInt32(&c.running, 1)
+	assert.True(t, c.acquire())
+	assert.False(t, c.acquire(), "Expected workers of the resource to be limited")
+
+	// Items of resources whose workers are busy are queued again
+	m.queue.Add(c.newItem("default/cm", ""))
+	assert.True(t, m.processNextItem())
+	assert.Equal(t, 0, m.queue.Len())
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return m.queue.Len() == 1, nil
+	})
+	assert.NoError(t, err, "Expected item to be queued again")
+
+	c.release()
+	assert.True(t, c.acquire(), "Expected released worker to be available")
+}
+
+func TestManager_RunWithUnlistableResource(t *testing.T) {
+	u := newConfigMap("cm", nil)
+	u.SetAnnotations(map[string]string{syncAnnotationKey: "true"})
+	source := fake.NewSimpleDynamicClient(runtime.NewScheme(), u)
+	secrets := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	source.PrependReactor("list", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(secrets.GroupResource(), "", fmt.Errorf("denied"))
+	})
+	target := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	registry := NewClusterRegistry([]Cluster{defaultCluster})
+	setClient(registry.Clients(), defaultCluster, target)
+	m := NewManager(source, record.NewFakeRecorder(100), nil, registry, NewSanitizerRegistry(nil), &Config{})
+	c := m.Add(*configMapGVR)
+	forbidden := m.Add(secrets)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go m.Run(1, stopCh, AlwaysLead())
+
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, err := target.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "cm", v1.GetOptions{})
+		return err == nil, nil
+	})
+	assert.NoError(t, err, "Expected resources to be synced while another resource can't be listed")
+	assert.True(t, c.HasSynced())
+	assert.False(t, forbidden.HasSynced())
+	assert.True(t, m.HasSynced(), "Expected manager not to wait for resources that can't be listed")
+}
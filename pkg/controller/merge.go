@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// lastAppliedAnnotationKey records the resource that synka last wrote to a cluster, like
+// kubectl.kubernetes.io/last-applied-configuration does for kubectl apply
+const lastAppliedAnnotationKey = "synka.io/last-applied-configuration"
+
+// merge creates or updates the resource u in a cluster with a three-way merge patch between what synka last wrote,
+// u and the live resource. Fields that were added to the resource in the cluster are kept, while fields that were
+// removed from u are removed from the cluster. Like updateOrCreate, existing resources are only modified if replace
+// is true and the resource is owned by synka or adopt is true. Returns the written resource along with the result of the write.
+func merge(ctx context.Context, client dynamic.Interface, gvr *schema.GroupVersionResource, u *unstructured.Unstructured, replace bool, adopt bool) (*unstructured.Unstructured, string, error) {
+
+	// Record what is written
+	modified, err := setLastApplied(u)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Create the resource if it doesn't exist
+	live, err := client.Resource(*gvr).Namespace(u.GetNamespace()).Get(ctx, u.GetName(), v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		result, err := client.Resource(*gvr).Namespace(u.GetNamespace()).Create(ctx, u, v1.CreateOptions{})
+		if err != nil {
+			return nil, "", err
+		}
+		return result, resultCreated, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !replace {
+		return live, resultSkipped, nil
+	}
+	if !adopt && !isAdoptable(live) && !isOwned(live, u, false) {
+		return nil, "", &OwnershipError{Namespace: u.GetNamespace(), Name: u.GetName()}
+	}
+
+	// Patch the difference, if any
+	current, err := live.MarshalJSON()
+	if err != nil {
+		return nil, "", err
+	}
+	original := []byte(live.GetAnnotations()[lastAppliedAnnotationKey])
+	patch, patchType, err := threeWayMergePatch(u.GroupVersionKind(), original, modified, current)
+	if err != nil {
+		return nil, "", err
+	}
+	if string(patch) == "{}" {
+		return live, resultUnchanged, nil
+	}
+	result, err := client.Resource(*gvr).Namespace(u.GetNamespace()).Patch(ctx, u.GetName(), patchType, patch, v1.PatchOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	return result, resultUpdated, nil
+}
+
+// setLastApplied stores u, without the annotation itself, in the last-applied annotation of u.
+// Returns u serialized with the annotation
+func setLastApplied(u *unstructured.Unstructured) ([]byte, error) {
+	annotations := u.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	delete(annotations, lastAppliedAnnotationKey)
+	u.SetAnnotations(annotations)
+	applied, err := u.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	annotations[lastAppliedAnnotationKey] = string(applied)
+	u.SetAnnotations(annotations)
+	return u.MarshalJSON()
+}
+
+// threeWayMergePatch creates a patch that turns current into modified, and removes fields that are in original but
+// not in modified. Kinds that are built into Kubernetes get a strategic merge patch, other kinds a JSON merge patch
+func threeWayMergePatch(gvk schema.GroupVersionKind, original, modified, current []byte) ([]byte, types.PatchType, error) {
+	if len(original) == 0 {
+		original = []byte("{}")
+	}
+	obj, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+		return patch, types.MergePatchType, err
+	}
+	meta, err := strategicpatch.NewPatchMetaFromStruct(obj)
+	if err != nil {
+		return nil, "", err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, meta, true)
+	return patch, types.StrategicMergePatchType, err
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+	"testing"
+)
+
+var widgetGVR = &schema.GroupVersionResource{
+	Group:    "example.com",
+	Version:  "v1",
+	Resource: "widgets",
+}
+
+func newWidget(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "widget", "namespace": "default"},
+		"spec":       spec,
+	}}
+}
+
+func TestMerge(t *testing.T) {
+	config := &Config{Name: "source"}
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+
+	source := newWidget(map[string]interface{}{"color": "red", "size": int64(1)})
+	desired := source.DeepCopy()
+	setOwnership(desired, source, config)
+	result, _, err := merge(context.Background(), client, widgetGVR, desired, true, false)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result.GetAnnotations()[lastAppliedAnnotationKey], "Expected last applied configuration to be recorded")
+
+	// Add a field in the cluster
+	live, err := client.Resource(*widgetGVR).Namespace("default").Get(context.Background(), "widget", v1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, unstructured.SetNestedField(live.Object, "local", "spec", "owner"))
+	_, err = client.Resource(*widgetGVR).Namespace("default").Update(context.Background(), live, v1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	// Remove a field in the source
+	source = newWidget(map[string]interface{}{"color": "blue"})
+	desired = source.DeepCopy()
+	setOwnership(desired, source, config)
+	result, _, err = merge(context.Background(), client, widgetGVR, desired, true, false)
+	assert.NoError(t, err)
+	spec, _, _ := unstructured.NestedMap(result.Object, "spec")
+	assert.Equal(t, map[string]interface{}{"color": "blue", "owner": "local"}, spec, "Expected local fields to be kept and removed fields to be removed")
+
+	foreign := newWidget(nil)
+	foreign.SetName("foreign")
+	client = fake.NewSimpleDynamicClient(runtime.NewScheme(), foreign)
+	desired.SetName("foreign")
+	_, _, err = merge(context.Background(), client, widgetGVR, desired, true, false)
+	assert.IsType(t, &OwnershipError{}, err)
+}
+
+func TestThreeWayMergePatch(t *testing.T) {
+	original := []byte(`{"data":{"a":"1","b":"2"}}`)
+	modified := []byte(`{"data":{"a":"1"}}`)
+	current := []byte(`{"data":{"a":"1","b":"2","c":"3"}}`)
+
+	patch, patchType, err := threeWayMergePatch(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, original, modified, current)
+	assert.NoError(t, err)
+	assert.Equal(t, types.StrategicMergePatchType, patchType, "Expected strategic merge patch for built-in kind")
+	assert.JSONEq(t, `{"data":{"b":null}}`, string(patch))
+
+	patch, patchType, err = threeWayMergePatch(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, nil, modified, current)
+	assert.NoError(t, err)
+	assert.Equal(t, types.MergePatchType, patchType, "Expected JSON merge patch for custom kind")
+	assert.JSONEq(t, `{}`, string(patch), "Expected nothing to be removed without a last applied configuration")
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"testing"
+)
+
+func TestController_metrics(t *testing.T) {
+	gvr := &schema.GroupVersionResource{Version: "v1", Resource: "configmaps-metrics"}
+	registry := NewClusterRegistry([]Cluster{defaultCluster})
+	setClient(registry.Clients(), defaultCluster, fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	c := NewManager(nil, record.NewFakeRecorder(10), nil, registry, NewSanitizerRegistry(nil), &Config{}).Add(*gvr)
+	c.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+	u := newConfigMap("cm", nil)
+	u.SetAnnotations(map[string]string{syncAnnotationKey: "true"})
+	assert.NoError(t, c.indexer.Add(u))
+
+	c.setChanged("default/cm")
+	assert.NoError(t, c.syncToStdout(workItem{key: "default/cm"}))
+	assert.NoError(t, c.syncToStdout(workItem{key: "default/cm"}))
+
+	resource := gvr.GroupResource().String()
+	assert.Equal(t, float64(1), testutil.ToFloat64(syncsTotal.WithLabelValues(resource, defaultCluster.Name, resultCreated)), "Unexpected number of creates")
+	assert.Equal(t, float64(1), testutil.ToFloat64(syncsTotal.WithLabelValues(resource, defaultCluster.Name, resultUpdated)), "Unexpected number of updates")
+	assert.True(t, testutil.ToFloat64(syncLag.WithLabelValues(resource, defaultCluster.Name)) > 0, "Expected lag to be recorded")
+
+	c.forgetChanged("default/cm")
+	_, ok := c.changed["default/cm"]
+	assert.False(t, ok, "Expected change to be forgotten")
+}
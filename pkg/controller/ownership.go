@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"strconv"
+)
+
+const (
+	managedByLabelKey          = "app.kubernetes.io/managed-by"
+	managedByLabelValue        = "synka"
+	instanceLabelKey           = "synka.io/instance"
+	sourceClusterAnnotationKey = "synka.io/source-cluster"
+	sourceUIDAnnotationKey     = "synka.io/source-uid"
+	adoptAnnotationKey         = "synka.io/adopt"
+	defaultInstance            = "synka"
+	defaultSourceName          = "source"
+)
+
+// OwnershipError is returned when synka refuses to modify a resource in a cluster that it doesn't own
+type OwnershipError struct {
+	Cluster   string
+	Namespace string
+	Name      string
+}
+
+func (e *OwnershipError) Error() string {
+	return fmt.Sprintf("Resource %s/%s on %s is not owned by synka. Annotate it with %s: true to adopt it", e.Namespace, e.Name, e.Cluster, adoptAnnotationKey)
+}
+
+// setOwnership stamps the ownership markers of the given source resource onto u
+func setOwnership(u *unstructured.Unstructured, source *unstructured.Unstructured, config *Config) {
+	labels := u.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[managedByLabelKey] = managedByLabelValue
+	labels[instanceLabelKey] = config.instanceName()
+	u.SetLabels(labels)
+
+	annotations := u.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[sourceClusterAnnotationKey] = config.sourceName()
+	annotations[sourceUIDAnnotationKey] = string(source.GetUID())
+	u.SetAnnotations(annotations)
+}
+
+// isOwned returns true if the resource u carries the same ownership markers as owner, which is expected
+// to have been stamped by setOwnership. Source UIDs are only compared if strict is true, since a source
+// resource that is deleted and recreated with the same name should still be allowed to update its copies.
+func isOwned(u *unstructured.Unstructured, owner *unstructured.Unstructured, strict bool) bool {
+	labels, ownerLabels := u.GetLabels(), owner.GetLabels()
+	if labels[managedByLabelKey] != managedByLabelValue || labels[instanceLabelKey] != ownerLabels[instanceLabelKey] {
+		return false
+	}
+	annotations, ownerAnnotations := u.GetAnnotations(), owner.GetAnnotations()
+	if annotations[sourceClusterAnnotationKey] != ownerAnnotations[sourceClusterAnnotationKey] {
+		return false
+	}
+	if strict && annotations[sourceUIDAnnotationKey] != ownerAnnotations[sourceUIDAnnotationKey] {
+		return false
+	}
+	return true
+}
+
+// isAdoptable returns true if the resource u is annotated with synka.io/adopt
+func isAdoptable(u *unstructured.Unstructured) bool {
+	adopt, _ := strconv.ParseBool(getValFromMap(adoptAnnotationKey, u.GetAnnotations()))
+	return adopt
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOwnership_setOwnership(t *testing.T) {
+	source := newConfigMap("cm", nil)
+	source.SetUID("1234")
+	u := source.DeepCopy()
+	setOwnership(u, source, &Config{})
+
+	assert.Equal(t, managedByLabelValue, u.GetLabels()[managedByLabelKey], "Unexpected label")
+	assert.Equal(t, defaultInstance, u.GetLabels()[instanceLabelKey], "Unexpected label")
+	assert.Equal(t, defaultSourceName, u.GetAnnotations()[sourceClusterAnnotationKey], "Unexpected annotation")
+	assert.Equal(t, "1234", u.GetAnnotations()[sourceUIDAnnotationKey], "Unexpected annotation")
+}
+
+func TestOwnership_isOwned(t *testing.T) {
+	source := newConfigMap("cm", nil)
+	source.SetUID("1234")
+	owner := source.DeepCopy()
+	setOwnership(owner, source, &Config{Name: "prod", Instance: "a"})
+
+	recreated := newConfigMap("cm", nil)
+	recreated.SetUID("5678")
+	u := recreated.DeepCopy()
+	setOwnership(u, recreated, &Config{Name: "prod", Instance: "a"})
+	assert.True(t, isOwned(u, owner, false), "Expected resource to be owned")
+	assert.False(t, isOwned(u, owner, true), "Expected resource with different source uid not to be owned")
+
+	other := source.DeepCopy()
+	setOwnership(other, source, &Config{Name: "prod", Instance: "b"})
+	assert.False(t, isOwned(other, owner, false), "Expected resource of other instance not to be owned")
+
+	assert.False(t, isOwned(source, owner, false), "Expected unmarked resource not to be owned")
+}
+
+func TestOwnership_isAdoptable(t *testing.T) {
+	u := newConfigMap("cm", nil)
+	assert.False(t, isAdoptable(u), "Unexpected bool")
+	u.SetAnnotations(map[string]string{adoptAnnotationKey: "true"})
+	assert.True(t, isAdoptable(u), "Unexpected bool")
+}
@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/amimof/synka/pkg/apis/synka/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+	"sort"
+	"sync"
+	"time"
+)
+
+var namespaceGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// PolicyStore keeps track of SyncPolicy resources and of the resources that they apply to.
+// A single PolicyStore is shared by all controllers.
+type PolicyStore struct {
+	client     dynamic.Interface
+	factory    dynamicinformer.DynamicSharedInformerFactory
+	policies   cache.SharedIndexInformer
+	namespaces cache.SharedIndexInformer
+	mu         sync.Mutex
+	// observed maps resource keys to the policy that applies to them and the clusters they are in sync on
+	observed  map[string]observation
+	listeners []func([]schema.GroupVersionResource, string)
+}
+
+type observation struct {
+	policy string
+	synced []string
+}
+
+// NewPolicyStore creates a PolicyStore that watches SyncPolicy resources using the given client
+func NewPolicyStore(client dynamic.Interface) *PolicyStore {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	p := &PolicyStore{
+		client:     client,
+		factory:    factory,
+		policies:   factory.ForResource(v1alpha1.SyncPolicyResource).Informer(),
+		namespaces: factory.ForResource(namespaceGVR).Informer(),
+		observed:   make(map[string]observation),
+	}
+	p.policies.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p.notify(policyResources(obj), "")
+		},
+		UpdateFunc: func(old, new interface{}) {
+			if !specChanged(old, new) {
+				return
+			}
+			p.notify(append(policyResources(old), policyResources(new)...), "")
+		},
+		DeleteFunc: func(obj interface{}) {
+			p.notify(policyResources(obj), "")
+		},
+	})
+	p.namespaces.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, new interface{}) {
+			o, n := old.(*unstructured.Unstructured), new.(*unstructured.Unstructured)
+			if equality.Semantic.DeepEqual(o.GetLabels(), n.GetLabels()) {
+				return
+			}
+			p.notify(p.namespacedResources(), n.GetName())
+		},
+	})
+	return p
+}
+
+// OnChange registers a function that is called with the resources that policies apply to when a policy is added,
+// updated or removed. When the labels of a namespace change, it is called with the resources of policies that select
+// namespaces, along with the name of the namespace. The namespace is empty if resources in every namespace are affected
+func (p *PolicyStore) OnChange(f func(gvrs []schema.GroupVersionResource, namespace string)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = append(p.listeners, f)
+}
+
+// notify calls every listener with the given resources and namespace
+func (p *PolicyStore) notify(gvrs []schema.GroupVersionResource, namespace string) {
+	if len(gvrs) == 0 {
+		return
+	}
+	p.mu.Lock()
+	listeners := p.listeners
+	p.mu.Unlock()
+	for _, f := range listeners {
+		f(gvrs, namespace)
+	}
+}
+
+// namespacedResources returns the resources of the policies that select namespaces by their labels
+func (p *PolicyStore) namespacedResources() []schema.GroupVersionResource {
+	var res []schema.GroupVersionResource
+	for _, policy := range p.list() {
+		if policy.Spec.NamespaceSelector != nil {
+			res = append(res, toGVRs(policy.Spec.Resources)...)
+		}
+	}
+	return res
+}
+
+// Run starts watching SyncPolicy resources and periodically updates their status once leading is closed.
+// It blocks until stopCh is closed
+func (p *PolicyStore) Run(stopCh <-chan struct{}, leading <-chan struct{}) {
+	p.factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, p.HasSynced) {
+		klog.Errorf("Timed out waiting for policy caches to sync")
+		return
+	}
+	select {
+	case <-leading:
+	case <-stopCh:
+		return
+	}
+	wait.Until(p.updateStatuses, time.Second*15, stopCh)
+}
+
+// HasSynced returns true if the policy caches have synced
+func (p *PolicyStore) HasSynced() bool {
+	return p.policies.HasSynced() && p.namespaces.HasSynced()
+}
+
+// Match returns the first policy, ordered by name, that applies to the resource u of the given GroupVersionResource.
+// Returns nil if no policy applies.
+func (p *PolicyStore) Match(gvr *schema.GroupVersionResource, u *unstructured.Unstructured) *v1alpha1.SyncPolicy {
+	for _, policy := range p.list() {
+		var nsLabels map[string]string
+		if ns, exists, err := p.namespaces.GetIndexer().GetByKey(u.GetNamespace()); err == nil && exists {
+			nsLabels = ns.(*unstructured.Unstructured).GetLabels()
+		}
+		ok, err := policyMatches(policy, gvr, u, nsLabels)
+		if err != nil {
+			klog.Errorf("Error evaluating policy %s: %v", policy.Name, err)
+			continue
+		}
+		if ok {
+			return policy
+		}
+	}
+	return nil
+}
+
+// Observe records the clusters that the resource identified by key is in sync on, and the policy that applies to it.
+// An empty policy name removes the resource from any policy.
+func (p *PolicyStore) Observe(key string, policy string, synced []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if policy == "" {
+		delete(p.observed, key)
+		return
+	}
+	p.observed[key] = observation{policy: policy, synced: synced}
+}
+
+// list returns all policies ordered by name
+func (p *PolicyStore) list() []*v1alpha1.SyncPolicy {
+	var res []*v1alpha1.SyncPolicy
+	for _, obj := range p.policies.GetStore().List() {
+		policy := &v1alpha1.SyncPolicy{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.(*unstructured.Unstructured).Object, policy); err != nil {
+			klog.Errorf("Error converting policy: %v", err)
+			continue
+		}
+		res = append(res, policy)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// statuses computes the status of each policy from the observed resources
+func (p *PolicyStore) statuses() map[string]v1alpha1.SyncPolicyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	counts := make(map[string]map[string]int)
+	matched := make(map[string]int)
+	for _, o := range p.observed {
+		matched[o.policy]++
+		if counts[o.policy] == nil {
+			counts[o.policy] = make(map[string]int)
+		}
+		for _, cluster := range o.synced {
+			counts[o.policy][cluster]++
+		}
+	}
+	res := make(map[string]v1alpha1.SyncPolicyStatus)
+	for policy, n := range matched {
+		status := v1alpha1.SyncPolicyStatus{Matched: n}
+		for cluster, inSync := range counts[policy] {
+			status.Clusters = append(status.Clusters, v1alpha1.ClusterSyncStatus{Name: cluster, InSync: inSync})
+		}
+		sort.Slice(status.Clusters, func(i, j int) bool {
+			return status.Clusters[i].Name < status.Clusters[j].Name
+		})
+		res[policy] = status
+	}
+	return res
+}
+
+// updateStatuses writes the status of every policy whose status has changed
+func (p *PolicyStore) updateStatuses() {
+	statuses := p.statuses()
+	for _, policy := range p.list() {
+		status := statuses[policy.Name]
+		if equality.Semantic.DeepEqual(policy.Status, status) {
+			continue
+		}
+		policy.Status = status
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(policy)
+		if err != nil {
+			klog.Errorf("Error converting policy %s: %v", policy.Name, err)
+			continue
+		}
+		_, err = p.client.Resource(v1alpha1.SyncPolicyResource).UpdateStatus(context.Background(), &unstructured.Unstructured{Object: obj}, v1.UpdateOptions{})
+		if err != nil {
+			klog.Errorf("Error updating status of policy %s: %v", policy.Name, err)
+		}
+	}
+}
+
+// policyResources returns the resources that the policy in obj, as received by an event handler, applies to
+func policyResources(obj interface{}) []schema.GroupVersionResource {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+	policy := &v1alpha1.SyncPolicy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, policy); err != nil {
+		klog.Errorf("Error converting policy: %v", err)
+		return nil
+	}
+	return toGVRs(policy.Spec.Resources)
+}
+
+// toGVRs converts the resources of a policy to GroupVersionResources
+func toGVRs(resources []v1alpha1.GroupVersionResource) []schema.GroupVersionResource {
+	res := make([]schema.GroupVersionResource, 0, len(resources))
+	for _, r := range resources {
+		res = append(res, schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource})
+	}
+	return res
+}
+
+// specChanged returns true if the spec of a policy differs between old and new, so that status updates are ignored
+func specChanged(old, new interface{}) bool {
+	o, n := old.(*unstructured.Unstructured), new.(*unstructured.Unstructured)
+	return !equality.Semantic.DeepEqual(o.Object["spec"], n.Object["spec"])
+}
+
+// policyMatches returns true if policy applies to the resource u of the given GroupVersionResource.
+// nsLabels are the labels of the namespace of the resource.
+func policyMatches(policy *v1alpha1.SyncPolicy, gvr *schema.GroupVersionResource, u *unstructured.Unstructured, nsLabels map[string]string) (bool, error) {
+	found := false
+	for _, r := range policy.Spec.Resources {
+		if r.Group == gvr.Group && r.Version == gvr.Version && r.Resource == gvr.Resource {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	if policy.Spec.NamespaceSelector != nil {
+		if u.GetNamespace() == "" {
+			return false, nil
+		}
+		selector, err := v1.LabelSelectorAsSelector(policy.Spec.NamespaceSelector)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(labels.Set(nsLabels)) {
+			return false, nil
+		}
+	}
+
+	if policy.Spec.Selector != nil {
+		selector, err := v1.LabelSelectorAsSelector(policy.Spec.Selector)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(labels.Set(u.GetLabels())) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// NewSyncConfigFromPolicy creates a SyncConfig from a SyncPolicy
+func NewSyncConfigFromPolicy(policy *v1alpha1.SyncPolicy) (SyncConfig, error) {
+	clusterSelector := ""
+	if policy.Spec.ClusterSelector != nil {
+		selector, err := v1.LabelSelectorAsSelector(policy.Spec.ClusterSelector)
+		if err != nil {
+			return SyncConfig{}, fmt.Errorf("Invalid cluster selector in policy %s: %v", policy.Name, err)
+		}
+		clusterSelector = selector.String()
+	}
+	strategy, err := parseStrategy(policy.Spec.Strategy)
+	if err != nil {
+		return SyncConfig{}, fmt.Errorf("Invalid policy %s: %v", policy.Name, err)
+	}
+	driftPolicy, err := parseDriftPolicy(policy.Spec.DriftPolicy)
+	if err != nil {
+		return SyncConfig{}, fmt.Errorf("Invalid policy %s: %v", policy.Name, err)
+	}
+	return SyncConfig{
+		Sync:            true,
+		SkipExisting:    policy.Spec.SkipExisting,
+		Orphan:          policy.Spec.Orphan,
+		Adopt:           policy.Spec.Adopt,
+		Clusters:        policy.Spec.Clusters,
+		ExcludeClusters: policy.Spec.ExcludeClusters,
+		ClusterSelector: clusterSelector,
+		Strategy:        strategy,
+		Force:           policy.Spec.Force,
+		DriftPolicy:     driftPolicy,
+	}, nil
+}
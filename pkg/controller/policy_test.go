@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"github.com/amimof/synka/pkg/apis/synka/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+	"testing"
+	"time"
+)
+
+func newSyncPolicy() *v1alpha1.SyncPolicy {
+	return &v1alpha1.SyncPolicy{
+		ObjectMeta: v1.ObjectMeta{Name: "policy"},
+		Spec: v1alpha1.SyncPolicySpec{
+			Resources: []v1alpha1.GroupVersionResource{{Version: "v1", Resource: "configmaps"}},
+		},
+	}
+}
+
+func TestPolicy_policyMatches(t *testing.T) {
+	policy := newSyncPolicy()
+	u := newConfigMap("cm", map[string]string{"app": "web"})
+
+	ok, err := policyMatches(policy, configMapGVR, u, nil)
+	assert.NoError(t, err)
+	assert.True(t, ok, "Expected policy to match")
+
+	policy.Spec.Selector = &v1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}
+	ok, err = policyMatches(policy, configMapGVR, u, nil)
+	assert.NoError(t, err)
+	assert.False(t, ok, "Expected policy not to match labels")
+
+	policy.Spec.Selector = &v1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	policy.Spec.NamespaceSelector = &v1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	ok, err = policyMatches(policy, configMapGVR, u, map[string]string{"team": "b"})
+	assert.NoError(t, err)
+	assert.False(t, ok, "Expected policy not to match namespace")
+
+	ok, err = policyMatches(policy, configMapGVR, u, map[string]string{"team": "a"})
+	assert.NoError(t, err)
+	assert.True(t, ok, "Expected policy to match namespace")
+
+	ok, err = policyMatches(policy, &schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, u, map[string]string{"team": "a"})
+	assert.NoError(t, err)
+	assert.False(t, ok, "Expected policy not to match resource")
+}
+
+func TestPolicy_NewSyncConfigFromPolicy(t *testing.T) {
+	policy := newSyncPolicy()
+	policy.Spec.SkipExisting = true
+	policy.Spec.Clusters = []string{"dev"}
+	policy.Spec.ClusterSelector = &v1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+
+	sc, err := NewSyncConfigFromPolicy(policy)
+	assert.NoError(t, err)
+	assert.True(t, sc.Sync, "Unexpected bool")
+	assert.True(t, sc.SkipExisting, "Unexpected bool")
+	assert.Equal(t, []string{"dev"}, sc.Clusters, "Unexpected clusters")
+	assert.Equal(t, "env=prod", sc.ClusterSelector, "Unexpected cluster selector")
+
+	policy.Spec.Strategy = "apply"
+	policy.Spec.Force = true
+	sc, err = NewSyncConfigFromPolicy(policy)
+	assert.NoError(t, err)
+	assert.Equal(t, StrategyApply, sc.Strategy, "Unexpected strategy")
+	assert.True(t, sc.Force, "Unexpected bool")
+
+	policy.Spec.Strategy = "unknown"
+	_, err = NewSyncConfigFromPolicy(policy)
+	assert.Error(t, err, "Expected unknown strategy to be rejected")
+}
+
+func TestPolicy_statuses(t *testing.T) {
+	p := NewPolicyStore(nil)
+	p.Observe("configmaps/default/a", "policy", []string{"dev", "prod"})
+	p.Observe("configmaps/default/b", "policy", []string{"dev"})
+	p.Observe("configmaps/default/c", "other", nil)
+	p.Observe("configmaps/default/c", "", nil)
+
+	statuses := p.statuses()
+	assert.Len(t, statuses, 1, "Unexpected number of statuses")
+	assert.Equal(t, v1alpha1.SyncPolicyStatus{
+		Matched: 2,
+		Clusters: []v1alpha1.ClusterSyncStatus{
+			{Name: "dev", InSync: 2},
+			{Name: "prod", InSync: 1},
+		},
+	}, statuses["policy"])
+}
+
+func TestPolicyStore_OnChange(t *testing.T) {
+	source := fake.NewSimpleDynamicClient(runtime.NewScheme(), newConfigMap("cm", nil))
+	target := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	registry := NewClusterRegistry([]Cluster{defaultCluster})
+	setClient(registry.Clients(), defaultCluster, target)
+	policies := NewPolicyStore(source)
+	m := NewManager(source, record.NewFakeRecorder(100), policies, registry, NewSanitizerRegistry(nil), &Config{})
+	m.Add(*configMapGVR)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go policies.Run(stopCh, AlwaysLead())
+	go m.Run(1, stopCh, AlwaysLead())
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return m.HasSynced(), nil
+	})
+	assert.NoError(t, err, "Expected caches to sync")
+	_, err = target.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "cm", v1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err), "Expected resource not to be synced without a policy")
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(newSyncPolicy())
+	assert.NoError(t, err)
+	policy := &unstructured.Unstructured{Object: obj}
+	policy.SetAPIVersion(v1alpha1.SchemeGroupVersion.String())
+	policy.SetKind("SyncPolicy")
+	_, err = source.Resource(v1alpha1.SyncPolicyResource).Create(context.Background(), policy, v1.CreateOptions{})
+	assert.NoError(t, err)
+
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, err := target.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "cm", v1.GetOptions{})
+		return err == nil, nil
+	})
+	assert.NoError(t, err, "Expected existing resource to be synced once a policy applies to it")
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"net/http"
+	"strings"
+)
+
+// reconcileAnnotationKey on a SynkaCluster syncs every resource to the cluster again whenever its value changes,
+// for example to a timestamp
+const reconcileAnnotationKey = "synka.io/reconcile"
+
+// ReconcileHandler serves an endpoint that syncs every resource to a cluster again, to rehydrate a cluster that
+// was wiped or rebuilt
+type ReconcileHandler struct {
+	clusters *ClusterRegistry
+}
+
+// NewReconcileHandler creates a ReconcileHandler for the clusters in the given registry
+func NewReconcileHandler(clusters *ClusterRegistry) *ReconcileHandler {
+	return &ReconcileHandler{
+		clusters: clusters,
+	}
+}
+
+// Register registers /reconcile/clusters/ on mux
+func (h *ReconcileHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/reconcile/clusters/", h.reconcile)
+}
+
+// reconcile syncs every resource to the cluster in a POST to /reconcile/clusters/<name>. Responds with 202 once the
+// resources are queued
+func (h *ReconcileHandler) reconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/reconcile/clusters/")
+	if name == "" {
+		http.Error(w, "no cluster given", http.StatusBadRequest)
+		return
+	}
+	if !h.clusters.Reconcile(name) {
+		http.Error(w, fmt.Sprintf("cluster %s not found", name), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprint(w, "ok")
+}
+
+// reconcileRequested returns true if the synka.io/reconcile annotation changed between the SynkaClusters old and new
+func reconcileRequested(old, new interface{}) bool {
+	o, ok := old.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	n, ok := new.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	value, ok := n.GetAnnotations()[reconcileAnnotationKey]
+	return ok && value != o.GetAnnotations()[reconcileAnnotationKey]
+}
+
+// isResync returns true if new is the same version of the resource as old, which is the case when the informer
+// delivers the resources in its cache again on a periodic resync
+func isResync(old, new interface{}) bool {
+	o, ok := old.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	n, ok := new.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	return o.GetResourceVersion() != "" && o.GetResourceVersion() == n.GetResourceVersion()
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReconcileHandler(t *testing.T) {
+	registry := NewClusterRegistry([]Cluster{defaultCluster})
+	c := NewManager(nil, record.NewFakeRecorder(10), nil, registry, NewSanitizerRegistry(nil), &Config{}).Add(*configMapGVR)
+	c.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, c.indexer.Add(newConfigMap("a", nil)))
+	assert.NoError(t, c.indexer.Add(newConfigMap("b", nil)))
+	registry.OnReconcile(c.enqueueCluster)
+	mux := http.NewServeMux()
+	NewReconcileHandler(registry).Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reconcile/clusters/minikube", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reconcile/clusters/other", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, 0, c.queue.Len())
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reconcile/clusters/minikube", nil))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, 2, c.queue.Len())
+	item, _ := c.queue.Get()
+	assert.Equal(t, "minikube", item.(workItem).cluster, "Expected resources to be synced to the reconciled cluster only")
+}
+
+func TestController_reconcileRequested(t *testing.T) {
+	old := newConfigMap("prod", nil)
+	assert.False(t, reconcileRequested(old, old.DeepCopy()))
+
+	new := old.DeepCopy()
+	new.SetAnnotations(map[string]string{reconcileAnnotationKey: "1"})
+	assert.True(t, reconcileRequested(old, new))
+	assert.False(t, reconcileRequested(new, new.DeepCopy()))
+}
+
+func TestController_isResync(t *testing.T) {
+	old := newConfigMap("cm", nil)
+	old.SetResourceVersion("1")
+	assert.True(t, isResync(old, old.DeepCopy()))
+
+	new := old.DeepCopy()
+	new.SetResourceVersion("2")
+	assert.False(t, isResync(old, new))
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"k8s.io/klog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClusterRegistry is the set of clusters that synka syncs resources to. Clusters are read from the configuration
+// file and from SynkaCluster resources, and can be added, updated and removed at runtime. If both define a cluster
+// with the same name, the SynkaCluster is used. A ClusterRegistry is safe for concurrent use.
+type ClusterRegistry struct {
+	mu        sync.RWMutex
+	static    map[string]Cluster
+	dynamic   map[string]Cluster
+	lastSync  map[string]time.Time
+	listeners []changeListener
+	reconcile []reconcileListener
+	nextID    int
+	clients   *ClientPool
+}
+
+// changeListener is a function registered with OnChange
+type changeListener struct {
+	id int
+	f  func([]string)
+}
+
+// reconcileListener is a function registered with OnReconcile
+type reconcileListener struct {
+	id int
+	f  func(string)
+}
+
+// NewClusterRegistry creates a ClusterRegistry with the clusters from the configuration file
+func NewClusterRegistry(clusters []Cluster) *ClusterRegistry {
+	r := &ClusterRegistry{
+		static:   make(map[string]Cluster),
+		dynamic:  make(map[string]Cluster),
+		lastSync: make(map[string]time.Time),
+		clients:  NewClientPool(),
+	}
+	for _, cluster := range clusters {
+		r.static[cluster.Name] = cluster
+	}
+	return r
+}
+
+// List returns all clusters ordered by name
+func (r *ClusterRegistry) List() []Cluster {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	merged := make(map[string]Cluster)
+	for name, cluster := range r.static {
+		merged[name] = cluster
+	}
+	for name, cluster := range r.dynamic {
+		merged[name] = cluster
+	}
+	res := make([]Cluster, 0, len(merged))
+	for _, cluster := range merged {
+		res = append(res, cluster)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// Get returns the cluster with the given name
+func (r *ClusterRegistry) Get(name string) (Cluster, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if cluster, ok := r.dynamic[name]; ok {
+		return cluster, true
+	}
+	cluster, ok := r.static[name]
+	return cluster, ok
+}
+
+// Set adds or updates a cluster defined by a SynkaCluster. Listeners are notified if the cluster has changed
+func (r *ClusterRegistry) Set(cluster Cluster) {
+	r.mu.Lock()
+	if existing, ok := r.dynamic[cluster.Name]; ok && existing.equal(cluster) {
+		r.mu.Unlock()
+		return
+	}
+	if _, ok := r.static[cluster.Name]; ok {
+		klog.Infof("Cluster %s is defined in both the configuration file and as a SynkaCluster, using the SynkaCluster", cluster.Name)
+	}
+	r.dynamic[cluster.Name] = cluster
+	r.mu.Unlock()
+
+	r.notify([]string{cluster.Name})
+}
+
+// SetStatic replaces the clusters from the configuration file. Listeners are notified of the clusters that were added,
+// updated or removed
+func (r *ClusterRegistry) SetStatic(clusters []Cluster) {
+	r.mu.Lock()
+	static := make(map[string]Cluster)
+	var changed []string
+	for _, cluster := range clusters {
+		static[cluster.Name] = cluster
+		if existing, ok := r.static[cluster.Name]; !ok || !existing.equal(cluster) {
+			changed = append(changed, cluster.Name)
+		}
+	}
+	var removed []string
+	for name := range r.static {
+		if _, ok := static[name]; !ok {
+			if _, ok := r.dynamic[name]; !ok {
+				r.clients.Remove(name)
+				removed = append(removed, name)
+			}
+			klog.Infof("Cluster %s was removed", name)
+		}
+	}
+	sort.Strings(removed)
+	changed = append(changed, removed...)
+	r.static = static
+	r.mu.Unlock()
+
+	r.notify(changed)
+}
+
+// notify calls every listener with the names of the clusters that were added, updated or removed
+func (r *ClusterRegistry) notify(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	r.mu.RLock()
+	listeners := r.listeners
+	r.mu.RUnlock()
+
+	klog.Infof("Clusters %s were added, updated or removed", strings.Join(names, ","))
+	for _, l := range listeners {
+		l.f(names)
+	}
+}
+
+// Remove removes a cluster defined by a SynkaCluster. Listeners are notified of the removal, or of the update if
+// the configuration file defines a cluster with the same name
+func (r *ClusterRegistry) Remove(name string) {
+	r.mu.Lock()
+	if _, ok := r.dynamic[name]; !ok {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.dynamic, name)
+	delete(r.lastSync, name)
+	if _, ok := r.static[name]; !ok {
+		r.clients.Remove(name)
+	}
+	klog.Infof("Cluster %s was removed", name)
+	r.mu.Unlock()
+
+	r.notify([]string{name})
+}
+
+// Clients returns the pool of clients shared by everyone using the registry
+func (r *ClusterRegistry) Clients() *ClientPool {
+	return r.clients
+}
+
+// OnChange registers a function that is called with the names of clusters that are added, updated or removed.
+// Returns a function that unregisters it
+func (r *ClusterRegistry) OnChange(f func([]string)) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	id := r.nextID
+	r.listeners = append(r.listeners, changeListener{id: id, f: f})
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		var listeners []changeListener
+		for _, l := range r.listeners {
+			if l.id != id {
+				listeners = append(listeners, l)
+			}
+		}
+		r.listeners = listeners
+	}
+}
+
+// OnReconcile registers a function that is called with the name of a cluster that every resource should be synced
+// to again. Returns a function that unregisters it
+func (r *ClusterRegistry) OnReconcile(f func(string)) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	id := r.nextID
+	r.reconcile = append(r.reconcile, reconcileListener{id: id, f: f})
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		var listeners []reconcileListener
+		for _, l := range r.reconcile {
+			if l.id != id {
+				listeners = append(listeners, l)
+			}
+		}
+		r.reconcile = listeners
+	}
+}
+
+// Reconcile syncs every resource to the cluster with the given name again, for example after the cluster was
+// rebuilt. Returns false if there is no such cluster
+func (r *ClusterRegistry) Reconcile(name string) bool {
+	if _, ok := r.Get(name); !ok {
+		return false
+	}
+	r.mu.RLock()
+	listeners := r.reconcile
+	r.mu.RUnlock()
+
+	klog.Infof("Reconciling every resource on cluster %s", name)
+	for _, l := range listeners {
+		l.f(name)
+	}
+	return true
+}
+
+// ObserveSync records that a resource was successfully synced to the cluster with the given name
+func (r *ClusterRegistry) ObserveSync(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastSync[name] = time.Now()
+}
+
+// LastSync returns the time that a resource was last successfully synced to the cluster with the given name
+func (r *ClusterRegistry) LastSync(name string) time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastSync[name]
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClusterRegistry_List(t *testing.T) {
+	r := NewClusterRegistry([]Cluster{{Name: "b", Server: "https://static"}, {Name: "a"}})
+	r.Set(Cluster{Name: "b", Server: "https://dynamic"})
+	r.Set(Cluster{Name: "c"})
+
+	clusters := r.List()
+	assert.Equal(t, []Cluster{{Name: "a"}, {Name: "b", Server: "https://dynamic"}, {Name: "c"}}, clusters, "Unexpected clusters")
+
+	r.Remove("b")
+	cluster, ok := r.Get("b")
+	assert.True(t, ok, "Expected static cluster to remain")
+	assert.Equal(t, "https://static", cluster.Server, "Unexpected server")
+
+	r.Remove("a")
+	_, ok = r.Get("a")
+	assert.True(t, ok, "Expected static cluster not to be removed")
+}
+
+func TestClusterRegistry_OnChange(t *testing.T) {
+	r := NewClusterRegistry(nil)
+	var changed []string
+	r.OnChange(func(names []string) {
+		changed = append(changed, names...)
+	})
+
+	r.Set(Cluster{Name: "a", Server: "https://a"})
+	r.Set(Cluster{Name: "a", Server: "https://a"})
+	r.Set(Cluster{Name: "a", Server: "https://b"})
+	assert.Equal(t, []string{"a", "a"}, changed, "Expected listeners to be notified of changes only")
+}
+
+func TestClusterRegistry_ObserveSync(t *testing.T) {
+	r := NewClusterRegistry(nil)
+	assert.True(t, r.LastSync("a").IsZero(), "Expected zero time")
+	r.ObserveSync("a")
+	assert.False(t, r.LastSync("a").IsZero(), "Expected time to be set")
+}
+
+func TestClusterRegistry_SetStatic(t *testing.T) {
+	r := NewClusterRegistry([]Cluster{{Name: "a"}, {Name: "b"}})
+	var changed []string
+	r.OnChange(func(names []string) {
+		changed = append(changed, names...)
+	})
+
+	r.SetStatic([]Cluster{{Name: "a"}, {Name: "b", Server: "https://b"}, {Name: "c"}})
+	assert.Equal(t, []string{"b", "c"}, changed, "Expected listeners to be notified of added and updated clusters")
+	assert.Len(t, r.List(), 3, "Unexpected number of clusters")
+
+	r.SetStatic([]Cluster{{Name: "c"}})
+	assert.Equal(t, []Cluster{{Name: "c"}}, r.List(), "Expected clusters to be removed")
+	assert.Equal(t, []string{"b", "c", "a", "b"}, changed, "Expected listeners to be notified of removed clusters")
+}
+
+func TestClusterRegistry_Remove(t *testing.T) {
+	r := NewClusterRegistry(nil)
+	r.Set(Cluster{Name: "a"})
+	var changed []string
+	unregister := r.OnChange(func(names []string) {
+		changed = append(changed, names...)
+	})
+
+	r.Remove("a")
+	r.Remove("a")
+	assert.Equal(t, []string{"a"}, changed, "Expected listeners to be notified of removed clusters")
+
+	unregister()
+	r.Set(Cluster{Name: "b"})
+	assert.Equal(t, []string{"a"}, changed, "Expected unregistered listeners not to be notified")
+}
+
+func TestClusterRegistry_OnReconcile(t *testing.T) {
+	r := NewClusterRegistry([]Cluster{{Name: "a"}})
+	var reconciled []string
+	unregister := r.OnReconcile(func(name string) {
+		reconciled = append(reconciled, name)
+	})
+
+	assert.True(t, r.Reconcile("a"))
+	assert.False(t, r.Reconcile("b"))
+	unregister()
+	assert.True(t, r.Reconcile("a"))
+	assert.Equal(t, []string{"a"}, reconciled, "Expected unregistered listeners not to be called")
+}
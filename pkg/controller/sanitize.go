@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"strings"
+	"sync"
+)
+
+// Sanitizer removes fields from a resource that are populated by the API server or only make sense in the
+// cluster that the resource was read from
+type Sanitizer func(u *unstructured.Unstructured)
+
+// SanitizeRule lists fields to remove from resources of a kind before they are written to clusters
+type SanitizeRule struct {
+	Group string `yaml:"group,omitempty"`
+	// Version of the kind. The rule applies to all versions if empty
+	Version string `yaml:"version,omitempty"`
+	Kind    string `yaml:"kind,omitempty"`
+	// Paths of the fields to remove, for example spec.template.metadata.annotations['example.com/revision'].
+	// Only fields in nested objects can be referenced, not fields of items in lists
+	Paths []string `yaml:"paths,omitempty"`
+}
+
+// validate returns all problems with the rule
+func (r *SanitizeRule) validate() []error {
+	var errs []error
+	if r.Kind == "" {
+		errs = append(errs, fmt.Errorf("No kind"))
+	}
+	if len(r.Paths) == 0 {
+		errs = append(errs, fmt.Errorf("No paths"))
+	}
+	for _, path := range r.Paths {
+		if _, err := parsePath(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// SanitizerRegistry holds the sanitizers of each GroupVersionKind. Sanitizers registered with an empty version
+// apply to all versions of a kind. Fields that are populated by the API server, such as metadata.uid and status,
+// are removed from resources of every kind.
+type SanitizerRegistry struct {
+	mu         sync.RWMutex
+	sanitizers map[schema.GroupVersionKind][]Sanitizer
+	rules      map[schema.GroupVersionKind][]Sanitizer
+}
+
+// NewSanitizerRegistry creates a registry with the built-in sanitizers and the given rules
+func NewSanitizerRegistry(rules []SanitizeRule) *SanitizerRegistry {
+	r := &SanitizerRegistry{
+		sanitizers: make(map[schema.GroupVersionKind][]Sanitizer),
+	}
+	r.Register(schema.GroupVersionKind{Kind: "Service"}, sanitizeService)
+	r.Register(schema.GroupVersionKind{Kind: "ServiceAccount"}, sanitizeServiceAccount)
+	r.Register(schema.GroupVersionKind{Kind: "Pod"}, removeFields([]string{"spec", "nodeName"}))
+	r.Register(schema.GroupVersionKind{Kind: "PersistentVolumeClaim"}, removeFields(
+		[]string{"spec", "volumeName"},
+		[]string{"metadata", "annotations", "pv.kubernetes.io/bind-completed"},
+		[]string{"metadata", "annotations", "pv.kubernetes.io/bound-by-controller"},
+		[]string{"metadata", "annotations", "volume.beta.kubernetes.io/storage-provisioner"},
+	))
+	r.Register(schema.GroupVersionKind{Group: "batch", Kind: "Job"}, sanitizeJob)
+	r.Register(schema.GroupVersionKind{Group: "apps", Kind: "Deployment"}, removeFields(
+		[]string{"metadata", "annotations", "deployment.kubernetes.io/revision"},
+	))
+	r.Register(schema.GroupVersionKind{Group: "apps", Kind: "DaemonSet"}, removeFields(
+		[]string{"metadata", "annotations", "deprecated.daemonset.template.generation"},
+	))
+	r.SetRules(rules)
+	return r
+}
+
+// Register adds sanitizers for resources of the given kind
+func (r *SanitizerRegistry) Register(gvk schema.GroupVersionKind, sanitizers ...Sanitizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sanitizers[gvk] = append(r.sanitizers[gvk], sanitizers...)
+}
+
+// SetRules replaces the sanitizers created from rules with the given rules. Rules are expected to be valid,
+// paths that can't be parsed are ignored.
+func (r *SanitizerRegistry) SetRules(rules []SanitizeRule) {
+	sanitizers := make(map[schema.GroupVersionKind][]Sanitizer)
+	for _, rule := range rules {
+		var paths [][]string
+		for _, path := range rule.Paths {
+			if fields, err := parsePath(path); err == nil {
+				paths = append(paths, fields)
+			}
+		}
+		gvk := schema.GroupVersionKind{Group: rule.Group, Version: rule.Version, Kind: rule.Kind}
+		sanitizers[gvk] = append(sanitizers[gvk], removeFields(paths...))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = sanitizers
+}
+
+// Sanitize removes all fields from u that must not be written to a target cluster
+func (r *SanitizerRegistry) Sanitize(u *unstructured.Unstructured) {
+	sanitizeObject(u)
+	for _, sanitize := range r.sanitizersFor(u.GroupVersionKind()) {
+		sanitize(u)
+	}
+}
+
+// sanitizersFor returns the built-in sanitizers followed by the sanitizers created from rules for the given kind
+func (r *SanitizerRegistry) sanitizersFor(gvk schema.GroupVersionKind) []Sanitizer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	gk := schema.GroupVersionKind{Group: gvk.Group, Kind: gvk.Kind}
+	var sanitizers []Sanitizer
+	for _, m := range []map[schema.GroupVersionKind][]Sanitizer{r.sanitizers, r.rules} {
+		sanitizers = append(sanitizers, m[gk]...)
+		if gvk.Version != "" {
+			sanitizers = append(sanitizers, m[gvk]...)
+		}
+	}
+	return sanitizers
+}
+
+// sanitizeObject removes fields that are populated by the API server from resources of any kind, along with
+// the status that synka records on source resources
+var sanitizeObject = removeFields(
+	[]string{"metadata", "resourceVersion"},
+	[]string{"metadata", "uid"},
+	[]string{"metadata", "creationTimestamp"},
+	[]string{"metadata", "deletionTimestamp"},
+	[]string{"metadata", "deletionGracePeriodSeconds"},
+	[]string{"metadata", "managedFields"},
+	[]string{"metadata", "selfLink"},
+	[]string{"metadata", "generation"},
+	[]string{"metadata", "ownerReferences"},
+	[]string{"metadata", "annotations", statusAnnotationKey},
+	[]string{"status"},
+)
+
+// sanitizeService removes the cluster IPs that are allocated by the API server. Headless services keep their cluster IP
+func sanitizeService(u *unstructured.Unstructured) {
+	clusterIP, _, _ := unstructured.NestedString(u.Object, "spec", "clusterIP")
+	if clusterIP == "None" {
+		return
+	}
+	unstructured.RemoveNestedField(u.Object, "spec", "clusterIP")
+	unstructured.RemoveNestedField(u.Object, "spec", "clusterIPs")
+}
+
+// sanitizeServiceAccount removes the token secrets that are generated for a service account
+func sanitizeServiceAccount(u *unstructured.Unstructured) {
+	secrets, found, err := unstructured.NestedSlice(u.Object, "secrets")
+	if !found || err != nil {
+		return
+	}
+	prefix := fmt.Sprintf("%s-token-", u.GetName())
+	var keep []interface{}
+	for _, secret := range secrets {
+		if m, ok := secret.(map[string]interface{}); ok {
+			if name, _ := m["name"].(string); strings.HasPrefix(name, prefix) {
+				continue
+			}
+		}
+		keep = append(keep, secret)
+	}
+	if len(keep) == 0 {
+		unstructured.RemoveNestedField(u.Object, "secrets")
+		return
+	}
+	_ = unstructured.SetNestedSlice(u.Object, keep, "secrets")
+}
+
+// sanitizeJob removes the selector and labels that are generated for a job, unless the job uses a manual selector
+func sanitizeJob(u *unstructured.Unstructured) {
+	manual, _, _ := unstructured.NestedBool(u.Object, "spec", "manualSelector")
+	if manual {
+		return
+	}
+	unstructured.RemoveNestedField(u.Object, "spec", "selector")
+	unstructured.RemoveNestedField(u.Object, "spec", "template", "metadata", "labels", "controller-uid")
+	unstructured.RemoveNestedField(u.Object, "spec", "template", "metadata", "labels", "job-name")
+}
+
+// removeFields returns a sanitizer that removes the fields at each of the given paths
+func removeFields(paths ...[]string) Sanitizer {
+	return func(u *unstructured.Unstructured) {
+		for _, fields := range paths {
+			unstructured.RemoveNestedField(u.Object, fields...)
+		}
+	}
+}
+
+// parsePath splits a path such as .metadata.annotations['example.com/revision'] into its fields
+func parsePath(path string) ([]string, error) {
+	var fields []string
+	rest := strings.TrimPrefix(path, "$")
+	for rest != "" {
+		var field string
+		if strings.HasPrefix(rest, "['") {
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid path %s: missing closing ']", path)
+			}
+			field, rest = rest[2:end], rest[end+2:]
+		} else {
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			field, rest = rest[:end], rest[end:]
+		}
+		if field == "" {
+			return nil, fmt.Errorf("Invalid path %s: empty field", path)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Invalid path %s: no fields", path)
+	}
+	return fields, nil
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+)
+
+func TestSanitizerRegistry_Sanitize(t *testing.T) {
+	r := NewSanitizerRegistry(nil)
+
+	svc := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":              "svc",
+			"uid":               "1234",
+			"resourceVersion":   "1",
+			"creationTimestamp": "2020-01-01T00:00:00Z",
+			"managedFields":     []interface{}{},
+			"ownerReferences":   []interface{}{},
+		},
+		"spec": map[string]interface{}{
+			"clusterIP":  "10.0.0.1",
+			"clusterIPs": []interface{}{"10.0.0.1"},
+			"ports":      []interface{}{},
+		},
+		"status": map[string]interface{}{},
+	}}
+	r.Sanitize(svc)
+	assert.Equal(t, map[string]interface{}{"name": "svc"}, svc.Object["metadata"], "Expected server populated metadata to be removed")
+	assert.Equal(t, map[string]interface{}{"ports": []interface{}{}}, svc.Object["spec"], "Expected cluster IPs to be removed")
+	assert.NotContains(t, svc.Object, "status", "Expected status to be removed")
+
+	headless := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"spec":       map[string]interface{}{"clusterIP": "None"},
+	}}
+	r.Sanitize(headless)
+	assert.Equal(t, map[string]interface{}{"clusterIP": "None"}, headless.Object["spec"], "Expected headless service to keep its cluster IP")
+
+	sa := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ServiceAccount",
+		"metadata":   map[string]interface{}{"name": "sa"},
+		"secrets": []interface{}{
+			map[string]interface{}{"name": "sa-token-abcde"},
+			map[string]interface{}{"name": "registry"},
+		},
+	}}
+	r.Sanitize(sa)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "registry"}}, sa.Object["secrets"], "Expected generated token secrets to be removed")
+}
+
+func TestSanitizerRegistry_SetRules(t *testing.T) {
+	r := NewSanitizerRegistry([]SanitizeRule{
+		{Group: "example.com", Kind: "Widget", Paths: []string{"spec.nodeRef", ".metadata.annotations['example.com/revision']"}},
+		{Group: "example.com", Version: "v2", Kind: "Widget", Paths: []string{"spec.v2"}},
+	})
+	newWidget := func(apiVersion string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       "Widget",
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{"example.com/revision": "1", "keep": "true"},
+			},
+			"spec": map[string]interface{}{"nodeRef": "node-1", "v2": true, "size": int64(1)},
+		}}
+	}
+
+	v1 := newWidget("example.com/v1")
+	r.Sanitize(v1)
+	assert.Equal(t, map[string]interface{}{"v2": true, "size": int64(1)}, v1.Object["spec"])
+	assert.Equal(t, map[string]string{"keep": "true"}, v1.GetAnnotations())
+
+	v2 := newWidget("example.com/v2")
+	r.Sanitize(v2)
+	assert.Equal(t, map[string]interface{}{"size": int64(1)}, v2.Object["spec"])
+
+	r.SetRules(nil)
+	v1 = newWidget("example.com/v1")
+	r.Sanitize(v1)
+	assert.Equal(t, map[string]interface{}{"nodeRef": "node-1", "v2": true, "size": int64(1)}, v1.Object["spec"], "Expected rules to be replaced")
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path   string
+		fields []string
+		err    bool
+	}{
+		{"spec.clusterIP", []string{"spec", "clusterIP"}, false},
+		{".spec.clusterIP", []string{"spec", "clusterIP"}, false},
+		{"$.metadata.annotations['example.com/revision']", []string{"metadata", "annotations", "example.com/revision"}, false},
+		{"metadata.annotations['a.b'].c", []string{"metadata", "annotations", "a.b", "c"}, false},
+		{"", nil, true},
+		{"spec..clusterIP", nil, true},
+		{"spec.ports[0]", nil, true},
+		{"metadata.annotations['a", nil, true},
+	}
+	for _, test := range tests {
+		fields, err := parsePath(test.path)
+		if test.err {
+			assert.Error(t, err, test.path)
+			continue
+		}
+		assert.NoError(t, err, test.path)
+		assert.Equal(t, test.fields, fields, test.path)
+	}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+)
+
+// statusAnnotationKey holds a summary of the sync results of a source resource when enabled in the configuration
+const statusAnnotationKey = "synka.io/status"
+
+// States of a resource in a cluster, as reported in the status annotation
+const (
+	stateSynced   = "Synced"
+	stateSkipped  = "Skipped"
+	stateConflict = "Conflict"
+	stateFailed   = "Failed"
+)
+
+// SyncStatus is the content of the synka.io/status annotation
+type SyncStatus struct {
+	Clusters map[string]ClusterStatus `json:"clusters"`
+}
+
+// ClusterStatus is the state of a resource in a cluster
+type ClusterStatus struct {
+	State string `json:"state"`
+	// Generation is the generation of the source resource that was last synced to the cluster
+	Generation int64  `json:"generation,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// recordResult records the result of syncing the resource u to the named cluster as metrics and events on u,
+// and returns the state of the resource in the cluster
+func (c *Controller) recordResult(u *unstructured.Unstructured, cluster string, op string, err error) ClusterStatus {
+	if oerr, ok := err.(*OwnershipError); ok {
+		syncsTotal.WithLabelValues(c.resource(), cluster, resultFailed).Inc()
+		c.recorder.Event(u, corev1.EventTypeWarning, reasonConflict, oerr.Error())
+		return ClusterStatus{State: stateConflict, Message: oerr.Error()}
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to sync resource: %v", err)
+		syncsTotal.WithLabelValues(c.resource(), cluster, resultFailed).Inc()
+		c.observeError(cluster, err)
+		c.recorder.Event(u, corev1.EventTypeWarning, reasonSyncFailed, msg)
+		return ClusterStatus{State: stateFailed, Message: msg}
+	}
+
+	syncsTotal.WithLabelValues(c.resource(), cluster, op).Inc()
+	switch op {
+	case resultSkipped:
+		c.recorder.Eventf(u, corev1.EventTypeNormal, reasonSkippedExisting, "Resource already exists on %s and was left untouched", cluster)
+		return ClusterStatus{State: stateSkipped}
+	case resultCreated, resultUpdated:
+		c.recorder.Eventf(u, corev1.EventTypeNormal, reasonSyncSucceeded, "Resource was %s on %s", op, cluster)
+	}
+	return ClusterStatus{State: stateSynced, Generation: u.GetGeneration()}
+}
+
+// writeStatus stores the given states of the resource u in its status annotation, unless they are already stored.
+// Selected clusters without a new state keep their previous state, and the generation last synced to clusters
+// that failed is kept from the previous status
+func (c *Controller) writeStatus(u *unstructured.Unstructured, selected []Cluster, clusters map[string]ClusterStatus) error {
+	var previous SyncStatus
+	if val, ok := u.GetAnnotations()[statusAnnotationKey]; ok {
+		_ = json.Unmarshal([]byte(val), &previous)
+	}
+	for _, cluster := range selected {
+		if _, ok := clusters[cluster.Name]; !ok {
+			if status, ok := previous.Clusters[cluster.Name]; ok {
+				clusters[cluster.Name] = status
+			}
+		}
+	}
+	for name, status := range clusters {
+		if status.State != stateSynced {
+			status.Generation = previous.Clusters[name].Generation
+			clusters[name] = status
+		}
+	}
+
+	data, err := json.Marshal(SyncStatus{Clusters: clusters})
+	if err != nil {
+		return err
+	}
+	if u.GetAnnotations()[statusAnnotationKey] == string(data) {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{statusAnnotationKey: string(data)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Resource(*c.gvr).Namespace(u.GetNamespace()).Patch(context.Background(), u.GetName(), types.MergePatchType, patch, v1.PatchOptions{})
+	return err
+}
+
+// onlyStatusChanged returns true if the only difference between the resources old and new is the status annotation,
+// so that writing the status doesn't cause the resource to be synced again
+func onlyStatusChanged(old, new interface{}) bool {
+	o, ok := old.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	n, ok := new.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	if o.GetAnnotations()[statusAnnotationKey] == n.GetAnnotations()[statusAnnotationKey] {
+		return false
+	}
+
+	o, n = o.DeepCopy(), n.DeepCopy()
+	for _, u := range []*unstructured.Unstructured{o, n} {
+		annotations := u.GetAnnotations()
+		delete(annotations, statusAnnotationKey)
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		u.SetAnnotations(annotations)
+		unstructured.RemoveNestedField(u.Object, "metadata", "resourceVersion")
+		unstructured.RemoveNestedField(u.Object, "metadata", "managedFields")
+	}
+	return reflect.DeepEqual(o.Object, n.Object)
+}
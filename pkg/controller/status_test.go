@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"testing"
+)
+
+func TestController_syncToStdoutStatus(t *testing.T) {
+	other := Cluster{Name: "other"}
+	registry := NewClusterRegistry([]Cluster{defaultCluster, other})
+	setClient(registry.Clients(), defaultCluster, fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	setClient(registry.Clients(), other, fake.NewSimpleDynamicClient(runtime.NewScheme(), newConfigMap("cm", nil)))
+
+	u := newConfigMap("cm", nil)
+	u.SetAnnotations(map[string]string{syncAnnotationKey: "true"})
+	u.SetGeneration(3)
+	source := fake.NewSimpleDynamicClient(runtime.NewScheme(), u.DeepCopy())
+	recorder := record.NewFakeRecorder(10)
+	c := NewManager(source, recorder, nil, registry, NewSanitizerRegistry(nil), &Config{Name: "source", StatusAnnotation: true}).Add(*configMapGVR)
+	c.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, c.indexer.Add(u))
+
+	assert.NoError(t, c.syncToStdout(workItem{key: "default/cm"}))
+	assert.Len(t, recorder.Events, 2)
+	events := []string{<-recorder.Events, <-recorder.Events}
+	assert.Contains(t, events, "Normal SyncSucceeded Resource was created on minikube")
+	assert.Contains(t, events, "Warning Conflict Resource default/cm on other is not owned by synka. Annotate it with synka.io/adopt: true to adopt it")
+
+	result, err := source.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "cm", v1.GetOptions{})
+	assert.NoError(t, err)
+	var status SyncStatus
+	assert.NoError(t, json.Unmarshal([]byte(result.GetAnnotations()[statusAnnotationKey]), &status))
+	assert.Equal(t, ClusterStatus{State: stateSynced, Generation: 3}, status.Clusters["minikube"])
+	assert.Equal(t, stateConflict, status.Clusters["other"].State)
+	assert.Equal(t, int64(0), status.Clusters["other"].Generation)
+
+	// The status is not written to clusters
+	client, _ := registry.Clients().Get(defaultCluster)
+	synced, err := client.Resource(*configMapGVR).Namespace("default").Get(context.Background(), "cm", v1.GetOptions{})
+	assert.NoError(t, err)
+	_, ok := synced.GetAnnotations()[statusAnnotationKey]
+	assert.False(t, ok, "Expected status annotation to be sanitized")
+}
+
+func TestController_onlyStatusChanged(t *testing.T) {
+	old := newConfigMap("cm", nil)
+	old.SetResourceVersion("1")
+
+	status := old.DeepCopy()
+	status.SetResourceVersion("2")
+	status.SetAnnotations(map[string]string{statusAnnotationKey: `{"clusters":{}}`})
+	assert.True(t, onlyStatusChanged(old, status))
+
+	changed := status.DeepCopy()
+	changed.SetLabels(map[string]string{"app": "test"})
+	assert.False(t, onlyStatusChanged(old, changed))
+
+	// Resyncs and updates that don't touch the status are passed through
+	assert.False(t, onlyStatusChanged(old, old))
+	assert.False(t, onlyStatusChanged(status, changed))
+}
@@ -1,18 +1,86 @@
 package controller
 
 import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"strconv"
+	"strings"
 )
 
 const (
-	syncAnnotationKey         = "synka.io/sync"
-	skipExistingAnnotationKey = "synka.io/skip-existing"
+	syncAnnotationKey            = "synka.io/sync"
+	skipExistingAnnotationKey    = "synka.io/skip-existing"
+	orphanAnnotationKey          = "synka.io/orphan"
+	clustersAnnotationKey        = "synka.io/clusters"
+	excludeClustersAnnotationKey = "synka.io/exclude-clusters"
+	clusterSelectorAnnotationKey = "synka.io/cluster-selector"
+	strategyAnnotationKey        = "synka.io/strategy"
+	forceAnnotationKey           = "synka.io/force"
+	driftPolicyAnnotationKey     = "synka.io/drift-policy"
 )
 
+// Strategy is the way that resources are written to clusters
+type Strategy string
+
+const (
+	// StrategyUpdate replaces existing resources with an update
+	StrategyUpdate Strategy = "update"
+	// StrategyApply uses server-side apply so that synka only owns the fields that it writes
+	StrategyApply Strategy = "apply"
+	// StrategyMerge patches existing resources with a three-way merge between what synka last wrote, the
+	// resource and the live resource in the cluster
+	StrategyMerge Strategy = "merge"
+)
+
+// parseStrategy returns the Strategy with the given name. Empty names are allowed and mean that the default is used
+func parseStrategy(name string) (Strategy, error) {
+	switch s := Strategy(name); s {
+	case "", StrategyUpdate, StrategyApply, StrategyMerge:
+		return s, nil
+	}
+	return "", fmt.Errorf("Invalid strategy %s: expected one of %s, %s, %s", name, StrategyUpdate, StrategyApply, StrategyMerge)
+}
+
+// DriftPolicy is what synka does when a resource is changed in a cluster so that it no longer matches the source
+type DriftPolicy string
+
+const (
+	// DriftRevert syncs the resource again, reverting the changes made in the cluster
+	DriftRevert DriftPolicy = "revert"
+	// DriftReport records an event on the source resource
+	DriftReport DriftPolicy = "report"
+	// DriftIgnore leaves the resource drifted until the source resource changes
+	DriftIgnore DriftPolicy = "ignore"
+)
+
+// parseDriftPolicy returns the DriftPolicy with the given name. Empty names are allowed and mean that the default is used
+func parseDriftPolicy(name string) (DriftPolicy, error) {
+	switch p := DriftPolicy(name); p {
+	case "", DriftRevert, DriftReport, DriftIgnore:
+		return p, nil
+	}
+	return "", fmt.Errorf("Invalid drift policy %s: expected one of %s, %s, %s", name, DriftRevert, DriftReport, DriftIgnore)
+}
+
 // SyncConfig is the configuration of the sync process. It defines how a resource is synchronised.
 type SyncConfig struct {
 	Sync         bool
 	SkipExisting bool
+	Orphan       bool
+	Adopt        bool
+	// Clusters limits the clusters that a resource is synced to. All clusters are used if empty
+	Clusters []string
+	// ExcludeClusters are clusters that a resource is never synced to
+	ExcludeClusters []string
+	// ClusterSelector is a label selector that limits the clusters that a resource is synced to
+	ClusterSelector string
+	// Strategy is the way that a resource is written to clusters. The default strategy is used if empty
+	Strategy Strategy
+	// Force takes ownership of fields that are owned by others when using server-side apply
+	Force bool
+	// DriftPolicy is what happens when a resource is changed in a cluster. The default policy is used if empty
+	DriftPolicy DriftPolicy
 }
 
 // NewSyncConfig returns a SyncConfig with default values
@@ -20,17 +88,98 @@ func NewSyncConfig() SyncConfig {
 	return SyncConfig{
 		Sync:         true,
 		SkipExisting: false,
+		Orphan:       false,
+		Adopt:        false,
 	}
 }
 
-// NewSyncConfigFrom creates a SyncConfig from a map[string]string
-func NewSyncConfigFrom(m map[string]string) SyncConfig {
+// NewSyncConfigFrom creates a SyncConfig from a map[string]string. Returns an error describing every strategy and drift
+// policy that isn't valid, along with a SyncConfig that uses the defaults in their place
+func NewSyncConfigFrom(m map[string]string) (SyncConfig, error) {
+	var errs []error
 	sync, _ := strconv.ParseBool(getValFromMap(syncAnnotationKey, m))
 	skipExisting, _ := strconv.ParseBool(getValFromMap(skipExistingAnnotationKey, m))
+	orphan, _ := strconv.ParseBool(getValFromMap(orphanAnnotationKey, m))
+	adopt, _ := strconv.ParseBool(getValFromMap(adoptAnnotationKey, m))
+	force, _ := strconv.ParseBool(getValFromMap(forceAnnotationKey, m))
+	strategy, err := parseStrategy(getValFromMap(strategyAnnotationKey, m))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Annotation %s: %v", strategyAnnotationKey, err))
+	}
+	driftPolicy, err := parseDriftPolicy(getValFromMap(driftPolicyAnnotationKey, m))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Annotation %s: %v", driftPolicyAnnotationKey, err))
+	}
 	return SyncConfig{
-		Sync:         sync,
-		SkipExisting: skipExisting,
+		Sync:            sync,
+		SkipExisting:    skipExisting,
+		Orphan:          orphan,
+		Adopt:           adopt,
+		Clusters:        splitList(getValFromMap(clustersAnnotationKey, m)),
+		ExcludeClusters: splitList(getValFromMap(excludeClustersAnnotationKey, m)),
+		ClusterSelector: getValFromMap(clusterSelectorAnnotationKey, m),
+		Strategy:        strategy,
+		Force:           force,
+		DriftPolicy:     driftPolicy,
+	}, utilerrors.NewAggregate(errs)
+}
+
+// selectClusters returns the clusters that are selected by sc, along with any cluster
+// names referenced by sc that doesn't exist in clusters. Returns an error if the cluster selector of sc can't be parsed
+func selectClusters(sc SyncConfig, clusters []Cluster) ([]Cluster, []string, error) {
+	selector, err := labels.Parse(sc.ClusterSelector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, cluster := range clusters {
+		known[cluster.Name] = true
+	}
+
+	var unknown []string
+	for _, name := range append(append([]string{}, sc.Clusters...), sc.ExcludeClusters...) {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+
+	var selected []Cluster
+	for _, cluster := range clusters {
+		if len(sc.Clusters) > 0 && !contains(sc.Clusters, cluster.Name) {
+			continue
+		}
+		if contains(sc.ExcludeClusters, cluster.Name) {
+			continue
+		}
+		if !selector.Matches(labels.Set(cluster.Labels)) {
+			continue
+		}
+		selected = append(selected, cluster)
+	}
+
+	return selected, unknown, nil
+}
+
+// splitList splits a comma separated string into a slice of trimmed non-empty strings
+func splitList(str string) []string {
+	var res []string
+	for _, s := range strings.Split(str, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// contains returns true if the slice of strings contains str
+func contains(s []string, str string) bool {
+	for _, v := range s {
+		if v == str {
+			return true
+		}
 	}
+	return false
 }
 
 // getValFromMap returns the value of a key in a map of strings
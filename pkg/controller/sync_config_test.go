@@ -9,17 +9,20 @@ func TestSyncConfig_NewSyncConfig(t *testing.T) {
 	sc := NewSyncConfig()
 	assert.True(t, sc.Sync, "Unexpected bool")
 	assert.False(t, sc.SkipExisting, "Unexpected bool")
+	assert.False(t, sc.Orphan, "Unexpected bool")
 }
 
 func TestSyncConfig_NewSyncConfigFrom(t *testing.T) {
 	annotations := map[string]string{
 		syncAnnotationKey:         "false",
 		skipExistingAnnotationKey: "true",
+		orphanAnnotationKey:       "true",
 	}
 
-	sc := NewSyncConfigFrom(annotations)
+	sc, _ := NewSyncConfigFrom(annotations)
 	assert.False(t, sc.Sync, "Unexpected bool")
 	assert.True(t, sc.SkipExisting, "Unexpected bool")
+	assert.True(t, sc.Orphan, "Unexpected bool")
 }
 
 func TestSyncConfig_getValFromMap(t *testing.T) {
@@ -34,3 +37,93 @@ func TestSyncConfig_getValFromMap(t *testing.T) {
 	s = getValFromMap("wrongKey", m)
 	assert.Equal(t, "", s, "Unexpected value")
 }
+
+func TestSyncConfig_selectClusters(t *testing.T) {
+	clusters := []Cluster{{Name: "dev"}, {Name: "staging"}, {Name: "prod"}}
+
+	sc, _ := NewSyncConfigFrom(map[string]string{})
+	selected, unknown, err := selectClusters(sc, clusters)
+	assert.NoError(t, err)
+	assert.Len(t, selected, 3, "Expected all clusters to be selected")
+	assert.Empty(t, unknown, "Unexpected unknown clusters")
+
+	sc, _ = NewSyncConfigFrom(map[string]string{
+		clustersAnnotationKey:        "dev, staging,qa",
+		excludeClustersAnnotationKey: "staging",
+	})
+	selected, unknown, err = selectClusters(sc, clusters)
+	assert.NoError(t, err)
+	assert.Equal(t, []Cluster{{Name: "dev"}}, selected, "Unexpected clusters")
+	assert.Equal(t, []string{"qa"}, unknown, "Unexpected unknown clusters")
+
+	sc, _ = NewSyncConfigFrom(map[string]string{
+		excludeClustersAnnotationKey: "prod",
+	})
+	selected, _, err = selectClusters(sc, clusters)
+	assert.NoError(t, err)
+	assert.Equal(t, []Cluster{{Name: "dev"}, {Name: "staging"}}, selected, "Unexpected clusters")
+}
+
+func TestSyncConfig_selectClustersWithSelector(t *testing.T) {
+	eu := Cluster{Name: "eu", Labels: map[string]string{"env": "prod", "region": "eu"}}
+	us := Cluster{Name: "us", Labels: map[string]string{"env": "prod", "region": "us"}}
+	dev := Cluster{Name: "dev", Labels: map[string]string{"env": "dev", "region": "eu"}}
+	clusters := []Cluster{eu, us, dev}
+
+	sc, _ := NewSyncConfigFrom(map[string]string{
+		clusterSelectorAnnotationKey: "env=prod,region in (eu,us)",
+	})
+	selected, _, err := selectClusters(sc, clusters)
+	assert.NoError(t, err)
+	assert.Equal(t, []Cluster{eu, us}, selected, "Unexpected clusters")
+
+	sc, _ = NewSyncConfigFrom(map[string]string{
+		clusterSelectorAnnotationKey: "region=eu",
+		excludeClustersAnnotationKey: "dev",
+	})
+	selected, _, err = selectClusters(sc, clusters)
+	assert.NoError(t, err)
+	assert.Equal(t, []Cluster{eu}, selected, "Unexpected clusters")
+
+	sc, _ = NewSyncConfigFrom(map[string]string{
+		clusterSelectorAnnotationKey: "env in (prod",
+	})
+	_, _, err = selectClusters(sc, clusters)
+	assert.Error(t, err)
+}
+
+func TestSyncConfig_splitList(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, splitList(" a,,b , "), "Unexpected list")
+	assert.Empty(t, splitList(""), "Unexpected list")
+}
+
+func TestSyncConfig_NewSyncConfigFromStrategy(t *testing.T) {
+	sc, err := NewSyncConfigFrom(map[string]string{strategyAnnotationKey: "apply", forceAnnotationKey: "true"})
+	assert.NoError(t, err)
+	assert.Equal(t, StrategyApply, sc.Strategy, "Unexpected strategy")
+	assert.True(t, sc.Force, "Expected force to be set")
+
+	sc, err = NewSyncConfigFrom(map[string]string{strategyAnnotationKey: "unknown"})
+	assert.Error(t, err, "Expected unknown strategy to be reported")
+	assert.Equal(t, Strategy(""), sc.Strategy, "Expected unknown strategy to fall back to the default")
+
+	config := &Config{}
+	assert.Equal(t, StrategyUpdate, config.defaultStrategy(), "Unexpected default strategy")
+	config.Strategy = "unknown"
+	assert.Error(t, config.Validate(), "Expected unknown strategy to be rejected")
+}
+
+func TestSyncConfig_NewSyncConfigFromDriftPolicy(t *testing.T) {
+	sc, err := NewSyncConfigFrom(map[string]string{driftPolicyAnnotationKey: "revert"})
+	assert.NoError(t, err)
+	assert.Equal(t, DriftRevert, sc.DriftPolicy, "Unexpected drift policy")
+
+	sc, err = NewSyncConfigFrom(map[string]string{driftPolicyAnnotationKey: "revet"})
+	assert.EqualError(t, err, "Annotation synka.io/drift-policy: Invalid drift policy revet: expected one of revert, report, ignore")
+	assert.Equal(t, DriftPolicy(""), sc.DriftPolicy, "Expected unknown drift policy to fall back to the default")
+
+	config := &Config{}
+	assert.Equal(t, DriftIgnore, config.defaultDriftPolicy(), "Unexpected default drift policy")
+	config.DriftPolicy = "unknown"
+	assert.Error(t, config.Validate(), "Expected unknown drift policy to be rejected")
+}
@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/amimof/synka/pkg/apis/synka/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+	"time"
+)
+
+const (
+	secretKubeconfigKey = "kubeconfig"
+	secretCaKey         = "ca"
+	secretCertKey       = "cert"
+	secretKeyKey        = "key"
+	secretTokenKey      = "token"
+
+	// secretRefIndex indexes SynkaClusters by the namespace/name of the Secret that they reference
+	secretRefIndex = "secretRef"
+)
+
+var secretGVR = corev1.SchemeGroupVersion.WithResource("secrets")
+
+// ClusterWatcher keeps a ClusterRegistry up to date with SynkaCluster resources and the Secrets that
+// they reference, and reports the connectivity of each cluster in the status of its SynkaCluster
+type ClusterWatcher struct {
+	client         dynamic.Interface
+	secrets        typedcorev1.SecretsGetter
+	registry       *ClusterRegistry
+	informer       cache.SharedIndexInformer
+	secretInformer cache.SharedIndexInformer
+}
+
+// NewClusterWatcher creates a ClusterWatcher that adds clusters to registry. Secrets referenced by
+// SynkaCluster resources are read using the secrets client.
+func NewClusterWatcher(client dynamic.Interface, secrets typedcorev1.SecretsGetter, registry *ClusterRegistry) *ClusterWatcher {
+	indexers := cache.Indexers{secretRefIndex: indexBySecretRef}
+	return &ClusterWatcher{
+		client:         client,
+		secrets:        secrets,
+		registry:       registry,
+		informer:       dynamicinformer.NewFilteredDynamicInformer(client, v1alpha1.SynkaClusterResource, v1.NamespaceAll, 0, indexers, nil).Informer(),
+		secretInformer: dynamicinformer.NewFilteredDynamicInformer(client, secretGVR, v1.NamespaceAll, 0, cache.Indexers{}, nil).Informer(),
+	}
+}
+
+// Run starts watching SynkaCluster resources and periodically probes the clusters once leading is closed.
+// It blocks until stopCh is closed
+func (w *ClusterWatcher) Run(stopCh <-chan struct{}, leading <-chan struct{}) {
+	w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: w.update,
+		UpdateFunc: func(old, new interface{}) {
+			w.update(new)
+			if reconcileRequested(old, new) {
+				w.registry.Reconcile(new.(*unstructured.Unstructured).GetName())
+			}
+		},
+		DeleteFunc: w.remove,
+	})
+	w.secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: w.reload,
+		UpdateFunc: func(old, new interface{}) {
+			w.reload(new)
+		},
+		DeleteFunc: w.reload,
+	})
+	go w.informer.Run(stopCh)
+	go w.secretInformer.Run(stopCh)
+
+	if !cache.WaitForCacheSync(stopCh, w.informer.HasSynced, w.secretInformer.HasSynced) {
+		klog.Errorf("Timed out waiting for cluster caches to sync")
+		return
+	}
+	select {
+	case <-leading:
+	case <-stopCh:
+		return
+	}
+
+	wait.Until(w.updateStatuses, time.Second*30, stopCh)
+}
+
+// update adds or updates the cluster defined by a SynkaCluster in the registry
+func (w *ClusterWatcher) update(obj interface{}) {
+	sc, err := toSynkaCluster(obj)
+	if err != nil {
+		klog.Errorf("Error converting cluster: %v", err)
+		return
+	}
+	if _, err := w.load(sc); err != nil {
+		klog.Errorf("Error loading cluster %s: %v", sc.Name, err)
+	}
+}
+
+// reload loads the clusters of every SynkaCluster that references the given Secret again, so that
+// changed credentials are picked up
+func (w *ClusterWatcher) reload(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("Error getting key of secret: %v", err)
+		return
+	}
+	objs, err := w.informer.GetIndexer().ByIndex(secretRefIndex, key)
+	if err != nil {
+		klog.Errorf("Error listing clusters of secret %s: %v", key, err)
+		return
+	}
+	for _, obj := range objs {
+		w.update(obj)
+	}
+}
+
+// remove removes the cluster defined by a SynkaCluster from the registry
+func (w *ClusterWatcher) remove(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		w.registry.Remove(u.GetName())
+	}
+}
+
+// load reads the secret of a SynkaCluster and adds the resulting cluster to the registry
+func (w *ClusterWatcher) load(sc *v1alpha1.SynkaCluster) (Cluster, error) {
+	ref := sc.Spec.SecretRef
+	secret, err := w.secrets.Secrets(ref.Namespace).Get(context.Background(), ref.Name, v1.GetOptions{})
+	if err != nil {
+		return Cluster{}, err
+	}
+	cluster, err := clusterFromSecret(sc, secret)
+	if err != nil {
+		return Cluster{}, err
+	}
+	w.registry.Set(cluster)
+	return cluster, nil
+}
+
+// updateStatuses probes each cluster and writes the status of every SynkaCluster whose status has changed
+func (w *ClusterWatcher) updateStatuses() {
+	for _, obj := range w.informer.GetStore().List() {
+		sc, err := toSynkaCluster(obj)
+		if err != nil {
+			klog.Errorf("Error converting cluster: %v", err)
+			continue
+		}
+
+		status := v1alpha1.SynkaClusterStatus{}
+		cluster, err := w.load(sc)
+		if err == nil {
+			status.ServerVersion, err = probe(cluster)
+		}
+		status.Connected = err == nil
+		if err != nil {
+			status.Message = err.Error()
+		}
+		if t := w.registry.LastSync(sc.Name); !t.IsZero() {
+			lastSync := v1.NewTime(t.Truncate(time.Second))
+			status.LastSyncTime = &lastSync
+		}
+
+		if equality.Semantic.DeepEqual(sc.Status, status) {
+			continue
+		}
+		sc.Status = status
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(sc)
+		if err != nil {
+			klog.Errorf("Error converting cluster %s: %v", sc.Name, err)
+			continue
+		}
+		_, err = w.client.Resource(v1alpha1.SynkaClusterResource).UpdateStatus(context.Background(), &unstructured.Unstructured{Object: u}, v1.UpdateOptions{})
+		if err != nil {
+			klog.Errorf("Error updating status of cluster %s: %v", sc.Name, err)
+		}
+	}
+}
+
+// probe connects to a cluster and returns the version of its API server
+func probe(cluster Cluster) (string, error) {
+	config, err := cluster.RESTConfig()
+	if err != nil {
+		return "", err
+	}
+	config.Timeout = time.Second * 10
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return "", err
+	}
+	version, err := client.ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	return version.GitVersion, nil
+}
+
+// indexBySecretRef returns the namespace/name of the Secret referenced by a SynkaCluster
+func indexBySecretRef(obj interface{}) ([]string, error) {
+	sc, err := toSynkaCluster(obj)
+	if err != nil {
+		return nil, err
+	}
+	ref := sc.Spec.SecretRef
+	return []string{ref.Namespace + "/" + ref.Name}, nil
+}
+
+// toSynkaCluster converts an object from the informer cache to a SynkaCluster
+func toSynkaCluster(obj interface{}) (*v1alpha1.SynkaCluster, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected type %T", obj)
+	}
+	sc := &v1alpha1.SynkaCluster{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// clusterFromSecret creates a Cluster from a SynkaCluster and the Secret that it references
+func clusterFromSecret(sc *v1alpha1.SynkaCluster, secret *corev1.Secret) (Cluster, error) {
+	cluster := Cluster{
+		Name:                  sc.Name,
+		Server:                sc.Spec.Server,
+		InsecureSkipTLSVerify: sc.Spec.InsecureSkipTLSVerify,
+		Labels:                sc.Labels,
+	}
+	if kubeconfig, ok := secret.Data[secretKubeconfigKey]; ok {
+		cluster.kubeconfig = kubeconfig
+		cluster.Context = sc.Spec.Context
+		return cluster, nil
+	}
+	if cluster.Server == "" {
+		return Cluster{}, fmt.Errorf("Cluster %s has no server and secret %s/%s has no %s key", sc.Name, secret.Namespace, secret.Name, secretKubeconfigKey)
+	}
+	cluster.Ca = base64.StdEncoding.EncodeToString(secret.Data[secretCaKey])
+	cluster.Cert = base64.StdEncoding.EncodeToString(secret.Data[secretCertKey])
+	cluster.Key = base64.StdEncoding.EncodeToString(secret.Data[secretKeyKey])
+	cluster.Token = string(secret.Data[secretTokenKey])
+	return cluster, nil
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"github.com/amimof/synka/pkg/apis/synka/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func TestSynkaCluster_clusterFromSecret(t *testing.T) {
+	sc := &v1alpha1.SynkaCluster{
+		ObjectMeta: v1.ObjectMeta{Name: "prod", Labels: map[string]string{"env": "prod"}},
+		Spec:       v1alpha1.SynkaClusterSpec{Server: "https://prod:6443"},
+	}
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			secretTokenKey: []byte("token"),
+			secretCaKey:    []byte("ca"),
+		},
+	}
+
+	cluster, err := clusterFromSecret(sc, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", cluster.Name, "Unexpected name")
+	assert.Equal(t, "token", cluster.Token, "Unexpected token")
+	assert.Equal(t, []byte("ca"), b64ToBytes(cluster.Ca), "Unexpected ca")
+	assert.Equal(t, "prod", cluster.Labels["env"], "Unexpected labels")
+
+	sc.Spec.Server = ""
+	_, err = clusterFromSecret(sc, secret)
+	assert.Error(t, err, "Expected error when server is missing")
+
+	secret.Data[secretKubeconfigKey] = []byte("apiVersion: v1\nkind: Config\nclusters:\n- name: prod\n  cluster:\n    server: https://kubeconfig:6443\ncontexts:\n- name: prod\n  context:\n    cluster: prod\ncurrent-context: prod\n")
+	cluster, err = clusterFromSecret(sc, secret)
+	assert.NoError(t, err)
+	config, err := cluster.RESTConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://kubeconfig:6443", config.Host, "Unexpected host")
+}
+
+func TestSynkaCluster_reloadOnSecretChange(t *testing.T) {
+	sc := &v1alpha1.SynkaCluster{
+		TypeMeta:   v1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: "SynkaCluster"},
+		ObjectMeta: v1.ObjectMeta{Name: "prod"},
+		Spec: v1alpha1.SynkaClusterSpec{
+			Server:    "https://prod:6443",
+			SecretRef: v1alpha1.SecretReference{Namespace: "synka", Name: "prod"},
+		},
+	}
+	secret := &corev1.Secret{
+		TypeMeta:   v1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: v1.ObjectMeta{Namespace: "synka", Name: "prod"},
+		Data:       map[string][]byte{secretTokenKey: []byte("old")},
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(sc)
+	assert.NoError(t, err)
+	s, err := runtime.DefaultUnstructuredConverter.ToUnstructured(secret)
+	assert.NoError(t, err)
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), &unstructured.Unstructured{Object: u}, &unstructured.Unstructured{Object: s})
+	secrets := fake.NewSimpleClientset(secret)
+	registry := NewClusterRegistry(nil)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go NewClusterWatcher(client, secrets.CoreV1(), registry).Run(stopCh, make(chan struct{}))
+
+	token := func() string {
+		cluster, _ := registry.Get("prod")
+		return cluster.Token
+	}
+	assert.Eventually(t, func() bool { return token() == "old" }, 5*time.Second, 10*time.Millisecond, "Expected cluster to be loaded")
+
+	// Rotate the credentials without touching the SynkaCluster
+	secret.Data[secretTokenKey] = []byte("new")
+	_, err = secrets.CoreV1().Secrets("synka").Update(context.Background(), secret, v1.UpdateOptions{})
+	assert.NoError(t, err)
+	s, err = runtime.DefaultUnstructuredConverter.ToUnstructured(secret)
+	assert.NoError(t, err)
+	_, err = client.Resource(secretGVR).Namespace("synka").Update(context.Background(), &unstructured.Unstructured{Object: s}, v1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return token() == "new" }, 5*time.Second, 10*time.Millisecond, "Expected cluster to be reloaded")
+}